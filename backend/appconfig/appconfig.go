@@ -19,6 +19,9 @@ var Instance *AppConfig
 func setDefaultParams() {
 	viper.SetDefault("server.port", "8001")
 	viper.SetDefault("server.domain", ".jitsu.com")
+	viper.SetDefault("soft_delete.retention", "720h")
+	viper.SetDefault("destinations.hosted.staging_retention", "72h")
+	viper.SetDefault("api_keys.rotation_grace_period", "72h")
 }
 
 func Init() error {
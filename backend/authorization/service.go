@@ -39,18 +39,19 @@ func NewService(ctx context.Context, firebaseViper *viper.Viper) (*Service, erro
 
 }
 
-func (s *Service) Authenticate(ctx context.Context, token string) (string, error) {
+//Authenticate return user's project id and user id
+func (s *Service) Authenticate(ctx context.Context, token string) (string, string, error) {
 	verifiedToken, err := s.authClient.VerifyIDToken(ctx, token)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	user, err := s.firestoreClient.Collection("users_info").Doc(verifiedToken.UID).Get(ctx)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	projectId, err := user.DataAt("_project._id")
 	projectIdString := fmt.Sprint(projectId)
-	return projectIdString, nil
+	return projectIdString, verifiedToken.UID, nil
 }
 
 func (s *Service) GenerateUserToken(ctx context.Context, uid string) (string, error) {
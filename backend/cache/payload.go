@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"github.com/jitsucom/enhosted/storages"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/safego"
+	"sync"
+	"time"
+)
+
+//Stats is a cache usage report
+type Stats struct {
+	Name               string  `json:"name"`
+	Version            string  `json:"version"`
+	Hits               uint64  `json:"hits"`
+	Rebuilds           uint64  `json:"rebuilds"`
+	Invalidations      uint64  `json:"invalidations"`
+	LastRebuildSeconds float64 `json:"last_rebuild_seconds"`
+	LastRebuildAt      string  `json:"last_rebuild_at,omitempty"`
+}
+
+//Payload keeps a built payload in memory and rebuilds it only when the version (e.g. _lastUpdated of source collections)
+//has been changed or the payload has been invalidated
+type Payload struct {
+	sync.Mutex
+
+	name    string
+	version func() (string, error)
+	build   func() (interface{}, error)
+
+	value        interface{}
+	valueVersion string
+	valid        bool
+
+	expirationLock sync.Mutex
+	expiresAt      time.Time
+	changedAt      time.Time
+
+	stats Stats
+}
+
+func NewPayload(name string, version func() (string, error), build func() (interface{}, error)) *Payload {
+	return &Payload{name: name, version: version, build: build, stats: Stats{Name: name}}
+}
+
+//Get return cached payload or rebuild it. If the version can't be got, payload is built without caching
+func (p *Payload) Get() (interface{}, error) {
+	version, err := p.version()
+	if err != nil {
+		logging.Warnf("[%s] cache is skipped: %v", p.name, err)
+		return p.build()
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.valid && p.valueVersion == version && !p.expired() {
+		p.stats.Hits++
+		return p.value, nil
+	}
+
+	start := time.Now()
+	value, err := p.build()
+	if err != nil {
+		return nil, err
+	}
+	rebuildTime := time.Now().Sub(start)
+
+	p.value = value
+	p.valueVersion = version
+	p.valid = true
+	p.stats.Version = version
+	p.stats.Rebuilds++
+	p.stats.LastRebuildSeconds = rebuildTime.Seconds()
+	p.stats.LastRebuildAt = start.UTC().Format(storages.LastUpdatedLayout)
+	logging.Infof("[%s] cache has been rebuilt in [%.2f] seconds", p.name, rebuildTime.Seconds())
+
+	return value, nil
+}
+
+//Invalidate force rebuilding payload on the next Get
+func (p *Payload) Invalidate() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.valid {
+		p.valid = false
+		p.stats.Invalidations++
+	}
+}
+
+//ExpireAt force rebuilding payload on the first Get after the time even if the version isn't changed (e.g. when payload
+//depends on schedules). Zero time means never. It might be called from the build func
+func (p *Payload) ExpireAt(t time.Time) {
+	p.expirationLock.Lock()
+	defer p.expirationLock.Unlock()
+
+	p.expiresAt = t
+}
+
+//ChangedAt set the last time when the payload content was changed without the version change (e.g. by schedules).
+//It is used in LastModified. It might be called from the build func
+func (p *Payload) ChangedAt(t time.Time) {
+	p.expirationLock.Lock()
+	defer p.expirationLock.Unlock()
+
+	p.changedAt = t
+}
+
+//LastModified return func which returns the latest of the version time and the time set with ChangedAt. The payload is rebuilt
+//first if it is expired. It is used with If-Modified-Since requests so they get the new payload after a schedule boundary
+//even if the source collections aren't changed
+func (p *Payload) LastModified(versionTime func() (*time.Time, error)) func() (*time.Time, error) {
+	return func() (*time.Time, error) {
+		lastModified, err := versionTime()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.Get(); err != nil {
+			return nil, err
+		}
+
+		p.expirationLock.Lock()
+		defer p.expirationLock.Unlock()
+		if p.changedAt.After(*lastModified) {
+			changedAt := p.changedAt
+			return &changedAt, nil
+		}
+		return lastModified, nil
+	}
+}
+
+func (p *Payload) expired() bool {
+	p.expirationLock.Lock()
+	defer p.expirationLock.Unlock()
+
+	return !p.expiresAt.IsZero() && !time.Now().Before(p.expiresAt)
+}
+
+//InvalidateOn invalidate payload on every storage change of subscribed collections
+func (p *Payload) InvalidateOn(subscription *storages.Subscription) {
+	safego.RunWithRestart(func() {
+		for range subscription.Changes {
+			p.Invalidate()
+		}
+	})
+}
+
+func (p *Payload) Stats() Stats {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.stats
+}
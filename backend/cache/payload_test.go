@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPayloadLastModified(t *testing.T) {
+	lastUpdated := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	versionTime := func() (*time.Time, error) {
+		t := lastUpdated
+		return &t, nil
+	}
+
+	var changedAt time.Time
+	builds := 0
+	payload := NewPayload("test", func() (string, error) { return lastUpdated.String(), nil }, nil)
+	payload.build = func() (interface{}, error) {
+		builds++
+		payload.ChangedAt(changedAt)
+		payload.ExpireAt(time.Now().Add(-time.Second))
+		return builds, nil
+	}
+	lastModified := payload.LastModified(versionTime)
+
+	actual, err := lastModified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !actual.Equal(lastUpdated) {
+		t.Errorf("LastModified() = %v, expected version time %v", actual, lastUpdated)
+	}
+
+	//schedule boundary has passed after the last collection update
+	changedAt = lastUpdated.Add(time.Hour)
+	actual, err = lastModified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !actual.Equal(changedAt) {
+		t.Errorf("LastModified() = %v, expected schedule change %v", actual, changedAt)
+	}
+	if builds != 2 {
+		t.Errorf("expired payload must be rebuilt before LastModified: %d builds", builds)
+	}
+
+	//collection has been updated after the schedule boundary
+	lastUpdated = changedAt.Add(time.Minute)
+	actual, err = lastModified()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !actual.Equal(lastUpdated) {
+		t.Errorf("LastModified() = %v, expected version time %v", actual, lastUpdated)
+	}
+}
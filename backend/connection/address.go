@@ -0,0 +1,85 @@
+package connection
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/lib/pq"
+	"net"
+	"syscall"
+	"time"
+)
+
+//nonPublicNetworks are address ranges which aren't checked by net.IP methods: private, shared (carrier-grade NAT),
+//"this network" and IPv6 unique local addresses
+var nonPublicNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "0.0.0.0/8", "fc00::/7")
+
+//publicDialer dials only public addresses. The check is made on the connected IP so host names which resolve
+//to a different address after the DNS step (DNS rebinding) are refused too
+var publicDialer = &net.Dialer{Timeout: stepTimeout, Control: func(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	return checkPublicIP(net.ParseIP(host))
+}}
+
+//checkPublicIP return error if the IP is loopback, link-local, private, multicast or unspecified: connection tests
+//are run from the manager servers and mustn't reach the manager internal network
+func checkPublicIP(ip net.IP) error {
+	if ip == nil {
+		return fmt.Errorf("Malformed IP address")
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("Address [%s] isn't public", ip)
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return fmt.Errorf("Address [%s] isn't public", ip)
+		}
+	}
+	return nil
+}
+
+//publicPostgresConnector opens lib/pq connections with publicDialer
+type publicPostgresConnector struct {
+	dsn string
+}
+
+func (ppc *publicPostgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pq.DialOpen(publicPostgresDialer{}, ppc.dsn)
+}
+
+func (ppc *publicPostgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+//publicPostgresDialer is lib/pq Dialer which uses publicDialer
+type publicPostgresDialer struct{}
+
+func (publicPostgresDialer) Dial(network, address string) (net.Conn, error) {
+	return publicDialer.Dial(network, address)
+}
+
+func (publicPostgresDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	dialer := *publicDialer
+	dialer.Timeout = timeout
+	return dialer.Dial(network, address)
+}
+
+func (publicPostgresDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return publicDialer.DialContext(ctx, network, address)
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
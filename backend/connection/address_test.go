@@ -0,0 +1,97 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jitsucom/enhosted/entities"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCheckPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"172.32.0.1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			err := checkPublicIP(net.ParseIP(tt.ip))
+			if tt.public && err != nil {
+				t.Errorf("expected public address: %v", err)
+			}
+			if !tt.public && err == nil {
+				t.Error("expected non public address error")
+			}
+		})
+	}
+}
+
+func TestNetworkRefusesNonPublicHosts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	for _, address := range []string{listener.Addr().String(), "localhost:5432"} {
+		d := &diagnostics{ctx: context.Background(), result: &entities.ConnectionTest{Ok: true}}
+		d.network([]string{address})
+
+		if d.result.Ok || len(d.result.Steps) != 2 {
+			t.Fatalf("[%s]: expected failed DNS and skipped TCP steps, got %+v", address, d.result)
+		}
+		if step := d.result.Steps[0]; step.Name != DNSStep || step.Status != entities.StepFailed {
+			t.Errorf("[%s]: expected failed DNS step, got %+v", address, step)
+		}
+		if step := d.result.Steps[1]; step.Name != TCPStep || step.Status != entities.StepSkipped {
+			t.Errorf("[%s]: expected skipped TCP step, got %+v", address, step)
+		}
+	}
+}
+
+func TestPublicDialerRefusesNonPublicAddresses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := publicDialer.Dial("tcp", listener.Addr().String())
+	if err == nil {
+		conn.Close()
+	}
+	if err == nil || !strings.Contains(err.Error(), "isn't public") {
+		t.Errorf("expected non public address error, got %v", err)
+	}
+
+	//Postgres driver dials after the DNS step so a changed DNS answer is refused too
+	db := sql.OpenDB(&publicPostgresConnector{dsn: "host=127.0.0.1 port=" + portOf(listener) + " dbname=db user=user sslmode=disable"})
+	defer db.Close()
+	if err := db.Ping(); err == nil || !strings.Contains(err.Error(), "isn't public") {
+		t.Errorf("expected non public address error, got %v", err)
+	}
+}
+
+func portOf(listener net.Listener) string {
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
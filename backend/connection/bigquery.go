@@ -0,0 +1,99 @@
+package connection
+
+import (
+	"cloud.google.com/go/bigquery"
+	"fmt"
+	"github.com/jitsucom/enhosted/destinations"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	bigQueryAddress        = "bigquery.googleapis.com:443"
+	defaultBigQueryDataset = "default"
+)
+
+//testRow is a row of BigQuery test table
+type testRow struct {
+	Id string `bigquery:"id"`
+}
+
+//diagnoseBigQuery run network, auth, dataset, create table and insert/read steps. The test table is deleted in the end
+func (d *diagnostics) diagnoseBigQuery(config *enstorages.DestinationConfig) {
+	if config.Google == nil {
+		d.step(AuthStep, func() (string, error) { return "", fmt.Errorf("google is required") })
+		return
+	}
+	d.network([]string{bigQueryAddress})
+
+	var client *bigquery.Client
+	d.step(AuthStep, func() (string, error) {
+		credentials, err := destinations.GoogleCredentials(config.Google.KeyFile)
+		if err != nil {
+			return "", err
+		}
+		if client, err = bigquery.NewClient(d.ctx, config.Google.Project, credentials); err != nil {
+			return "", fmt.Errorf("Error creating BigQuery client: %v", err)
+		}
+		return "BigQuery client has been created", nil
+	})
+	if client != nil {
+		defer client.Close()
+	}
+
+	datasetName := config.Google.Dataset
+	if datasetName == "" {
+		datasetName = defaultBigQueryDataset
+	}
+	dataset := client.Dataset(datasetName)
+	d.step(SchemaStep, func() (string, error) {
+		ctx, cancel := d.timeout()
+		defer cancel()
+		if _, err := dataset.Metadata(ctx); err != nil {
+			return "", fmt.Errorf("Error getting dataset [%s]: %v", datasetName, err)
+		}
+		return fmt.Sprintf("Dataset [%s] exists", datasetName), nil
+	})
+
+	tableName := testTableName()
+	table := dataset.Table(tableName)
+	created := d.step(CreateTableStep, func() (string, error) {
+		ctx, cancel := d.timeout()
+		defer cancel()
+		schema := bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}}
+		if err := table.Create(ctx, &bigquery.TableMetadata{Schema: schema}); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Table [%s] has been created", tableName), nil
+	})
+	if created {
+		defer func() {
+			ctx, cancel := d.timeout()
+			defer cancel()
+			table.Delete(ctx)
+		}()
+	}
+
+	d.step(InsertReadStep, func() (string, error) {
+		ctx, cancel := d.timeout()
+		defer cancel()
+		if err := table.Inserter().Put(ctx, &testRow{Id: tableName}); err != nil {
+			return "", fmt.Errorf("Error inserting test row: %v", err)
+		}
+
+		query := client.Query(fmt.Sprintf("SELECT id FROM `%s.%s.%s` WHERE id = @id", config.Google.Project, datasetName, tableName))
+		query.Parameters = []bigquery.QueryParameter{{Name: "id", Value: tableName}}
+		rows, err := query.Read(ctx)
+		if err != nil {
+			return "", fmt.Errorf("Error reading test row: %v", err)
+		}
+		row := &testRow{}
+		if err := rows.Next(row); err != nil {
+			if err == iterator.Done {
+				return "", fmt.Errorf("Test row hasn't been read back")
+			}
+			return "", fmt.Errorf("Error reading test row: %v", err)
+		}
+		return "Test row has been inserted and read back", nil
+	})
+}
@@ -0,0 +1,243 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/random"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DNSStep         = "dns"
+	TCPStep         = "tcp"
+	AuthStep        = "auth"
+	SchemaStep      = "schema"
+	CreateTableStep = "create_table"
+	InsertReadStep  = "insert_read"
+	StagingStep     = "staging"
+	EventNativeStep = "eventnative"
+
+	stepTimeout = 15 * time.Second
+	timeLayout  = "2006-01-02T15:04:05.000Z"
+)
+
+var hints = map[string]string{
+	DNSStep:         "Check the host name. It must be resolvable from the public internet to a public address",
+	TCPStep:         "Check the port and that the firewall allows incoming connections from Jitsu servers",
+	AuthStep:        "Check the user name and the password (or the key) and that the user is allowed to connect to the database",
+	SchemaStep:      "Create the schema (dataset) or grant the user permission to use it",
+	CreateTableStep: "Grant the user permission to create tables in the schema (dataset)",
+	InsertReadStep:  "Grant the user INSERT and SELECT permissions on the schema (dataset) tables",
+	StagingStep:     "Check the bucket name, the region and that the credentials allow writing and deleting objects",
+	EventNativeStep: "EventNative servers couldn't connect to the destination. Check that the firewall allows connections from EventNative servers",
+}
+
+//Diagnose run the destination connection test step by step: DNS resolution, TCP connect, auth, schema existence,
+//table creation, test insert and read back and staging bucket write. Database steps are skipped after the first failed one.
+//Steps which aren't applicable for the destination type aren't reported. eventnativeTest is run last if it isn't nil.
+//Messages don't contain the destination secrets
+func Diagnose(ctx context.Context, destinationUid string, config *enstorages.DestinationConfig, eventnativeTest func() error) *entities.ConnectionTest {
+	d := &diagnostics{ctx: ctx, result: &entities.ConnectionTest{DestinationUid: destinationUid, Ok: true, TestedAt: time.Now().UTC().Format(timeLayout), Steps: []*entities.ConnectionTestStep{}},
+		secrets: secretsOf(config)}
+
+	switch config.Type {
+	case enstorages.PostgresType, enstorages.RedshiftType, enstorages.ClickHouseType, enstorages.SnowflakeType:
+		target, err := newSQLTarget(config)
+		if err != nil {
+			d.step(AuthStep, func() (string, error) { return "", err })
+			break
+		}
+		d.diagnoseSQL(target)
+	case enstorages.BigQueryType:
+		d.diagnoseBigQuery(config)
+	case enstorages.GoogleAnalyticsType:
+		d.diagnoseEndpoint("https://www.google-analytics.com")
+	}
+
+	d.diagnoseStaging(config)
+
+	if eventnativeTest != nil {
+		d.independentStep(EventNativeStep, func() (string, error) {
+			if err := eventnativeTest(); err != nil {
+				return "", err
+			}
+			return "Connection established from EventNative", nil
+		})
+	}
+	return d.result
+}
+
+//diagnostics collects steps results
+type diagnostics struct {
+	ctx     context.Context
+	result  *entities.ConnectionTest
+	secrets []string
+	//failed is true if a dependent step has been failed. All next dependent steps are skipped
+	failed bool
+}
+
+//step run the check if previous dependent steps are ok
+func (d *diagnostics) step(name string, check func() (string, error)) bool {
+	if d.failed {
+		d.skip(name)
+		return false
+	}
+	if !d.independentStep(name, check) {
+		d.failed = true
+		return false
+	}
+	return true
+}
+
+//skip report steps as skipped because of the previous failed step
+func (d *diagnostics) skip(names ...string) {
+	for _, name := range names {
+		d.result.Steps = append(d.result.Steps, &entities.ConnectionTestStep{Name: name, Status: entities.StepSkipped, Message: "Skipped because the previous step failed"})
+	}
+}
+
+//independentStep run the check regardless of previous steps results
+func (d *diagnostics) independentStep(name string, check func() (string, error)) bool {
+	start := time.Now()
+	message, err := check()
+	step := &entities.ConnectionTestStep{Name: name, Status: entities.StepOk, Message: d.redact(message), DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		step.Status = entities.StepFailed
+		step.Message = d.redact(err.Error())
+		step.Hint = hints[name]
+		d.result.Ok = false
+	}
+	d.result.Steps = append(d.result.Steps, step)
+	return err == nil
+}
+
+//network run DNS resolution and TCP connect steps for every host:port address. Hosts which resolve to non public
+//addresses fail the DNS step and aren't connected
+func (d *diagnostics) network(addresses []string) {
+	d.step(DNSStep, func() (string, error) {
+		var resolved []string
+		for _, address := range addresses {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return "", fmt.Errorf("Malformed address [%s]: %v", address, err)
+			}
+			ctx, cancel := context.WithTimeout(d.ctx, stepTimeout)
+			ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+			cancel()
+			if err != nil {
+				return "", fmt.Errorf("Host [%s] can't be resolved: %v", host, err)
+			}
+			var ips []string
+			for _, ipAddr := range ipAddrs {
+				if err := checkPublicIP(ipAddr.IP); err != nil {
+					return "", fmt.Errorf("Host [%s] can't be used: %v", host, err)
+				}
+				ips = append(ips, ipAddr.IP.String())
+			}
+			resolved = append(resolved, host+" -> "+strings.Join(ips, ", "))
+		}
+		return strings.Join(resolved, "; "), nil
+	})
+
+	d.step(TCPStep, func() (string, error) {
+		for _, address := range addresses {
+			conn, err := publicDialer.DialContext(d.ctx, "tcp", address)
+			if err != nil {
+				return "", fmt.Errorf("Can't connect to [%s]: %v", address, err)
+			}
+			conn.Close()
+		}
+		return "Connected to " + strings.Join(addresses, ", "), nil
+	})
+}
+
+//diagnoseEndpoint run network steps for URL host
+func (d *diagnostics) diagnoseEndpoint(endpoint string) {
+	address, err := urlAddress(endpoint)
+	if err != nil {
+		d.step(DNSStep, func() (string, error) { return "", err })
+		d.skip(TCPStep)
+		return
+	}
+	d.network([]string{address})
+}
+
+//redact replace secrets in the message
+func (d *diagnostics) redact(message string) string {
+	for _, secret := range d.secrets {
+		message = strings.ReplaceAll(message, secret, destinations.SecretMask)
+	}
+	return message
+}
+
+//secretsOf return config credentials which mustn't be in test results
+func secretsOf(config *enstorages.DestinationConfig) []string {
+	var secrets []string
+	add := func(values ...string) {
+		for _, value := range values {
+			//too short values are replaced everywhere in messages
+			if len(value) >= 4 {
+				secrets = append(secrets, value, url.QueryEscape(value), url.PathEscape(value))
+			}
+		}
+	}
+
+	if config.DataSource != nil {
+		add(config.DataSource.Password)
+	}
+	if config.Snowflake != nil {
+		add(config.Snowflake.Password)
+	}
+	if config.S3 != nil {
+		add(config.S3.SecretKey)
+	}
+	if config.ClickHouse != nil {
+		for _, dsn := range config.ClickHouse.Dsns {
+			if dsnUrl, err := url.Parse(strings.TrimSpace(dsn)); err == nil && dsnUrl.User != nil {
+				password, _ := dsnUrl.User.Password()
+				add(password)
+			}
+		}
+	}
+	return secrets
+}
+
+//urlAddress return host:port of the URL. Port is set by the scheme if it is absent
+func urlAddress(rawUrl string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil {
+		return "", fmt.Errorf("Malformed URL: %v", err)
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("URL doesn't have a host")
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+//testTableName return a unique table name for create table and insert steps
+func testTableName() string {
+	return "jitsu_connection_test_" + random.LowerCaseString(8)
+}
+
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (d *diagnostics) timeout() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(d.ctx, stepTimeout)
+}
@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"database/sql"
+	"fmt"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	sf "github.com/snowflakedb/gosnowflake"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultPostgresPort   = 5432
+	defaultRedshiftPort   = 5439
+	defaultClickHousePort = 8123
+	snowflakeHostSuffix   = ".snowflakecomputing.com"
+)
+
+//sqlTarget is a database/sql destination with dialect specific statements. %s in statements is a table name
+type sqlTarget struct {
+	//open is nil if the driver can't be restricted to public addresses. Database steps of such targets are checked
+	//only by EventNative
+	open      func() (*sql.DB, error)
+	addresses []string
+
+	schema         string
+	schemaExists   string
+	createTable    string
+	insert         string
+	selectInserted string
+	dropTable      string
+}
+
+//newSQLTarget return database/sql target of Postgres, Redshift, ClickHouse or Snowflake config
+func newSQLTarget(config *enstorages.DestinationConfig) (*sqlTarget, error) {
+	switch config.Type {
+	case enstorages.PostgresType, enstorages.RedshiftType:
+		if config.DataSource == nil {
+			return nil, fmt.Errorf("datasource is required")
+		}
+		return postgresTarget(config.DataSource, config.Type == enstorages.RedshiftType), nil
+	case enstorages.ClickHouseType:
+		if config.ClickHouse == nil || len(config.ClickHouse.Dsns) == 0 {
+			return nil, fmt.Errorf("clickhouse DSNs are required")
+		}
+		return clickHouseTarget(config.ClickHouse)
+	case enstorages.SnowflakeType:
+		if config.Snowflake == nil {
+			return nil, fmt.Errorf("snowflake is required")
+		}
+		return snowflakeTarget(config.Snowflake)
+	}
+	return nil, fmt.Errorf("Unsupported destination type: %s", config.Type)
+}
+
+func postgresTarget(dataSource *enadapters.DataSourceConfig, redshift bool) *sqlTarget {
+	port := dataSource.Port
+	if port == 0 {
+		port = defaultPostgresPort
+		if redshift {
+			port = defaultRedshiftPort
+		}
+	}
+	schema := dataSource.Schema
+	if schema == "" {
+		schema = "public"
+	}
+
+	//the same connection string as eventnative builds
+	dsn := fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s ", dataSource.Host, port, dataSource.Db, dataSource.Username, dataSource.Password)
+	for name, value := range dataSource.Parameters {
+		dsn += name + "=" + value + " "
+	}
+
+	table := `"` + schema + `"."%s"`
+	return &sqlTarget{
+		open: func() (*sql.DB, error) {
+			return sql.OpenDB(&publicPostgresConnector{dsn: dsn}), nil
+		},
+		addresses:      []string{hostPort(dataSource.Host, port)},
+		schema:         schema,
+		schemaExists:   `SELECT count(*) FROM information_schema.schemata WHERE schema_name = $1`,
+		createTable:    `CREATE TABLE ` + table + ` (id varchar(64))`,
+		insert:         `INSERT INTO ` + table + ` (id) VALUES ($1)`,
+		selectInserted: `SELECT id FROM ` + table + ` WHERE id = $1`,
+		dropTable:      `DROP TABLE ` + table,
+	}
+}
+
+//clickHouseTarget checks network of all DSNs hosts. ClickHouse driver HTTP transport dials any address so database steps
+//aren't run
+func clickHouseTarget(config *enadapters.ClickHouseConfig) (*sqlTarget, error) {
+	var addresses []string
+	for _, dsn := range config.Dsns {
+		dsnUrl, err := url.Parse(strings.TrimSpace(dsn))
+		if err != nil {
+			//parsing error isn't returned because it contains the DSN with credentials
+			return nil, fmt.Errorf("Malformed ClickHouse DSN")
+		}
+		port := dsnUrl.Port()
+		if port == "" {
+			port = fmt.Sprint(defaultClickHousePort)
+		}
+		addresses = append(addresses, dsnUrl.Hostname()+":"+port)
+	}
+
+	return &sqlTarget{addresses: addresses}, nil
+}
+
+func snowflakeTarget(config *enadapters.SnowflakeConfig) (*sqlTarget, error) {
+	schema := config.Schema
+	if schema == "" {
+		schema = "PUBLIC"
+	}
+	dsn, err := sf.DSN(&sf.Config{Account: config.Account, User: config.Username, Password: config.Password, Port: config.Port,
+		Database: config.Db, Schema: schema, Warehouse: config.Warehouse, Params: config.Parameters})
+	if err != nil {
+		return nil, fmt.Errorf("Error building Snowflake connection string: %v", err)
+	}
+	port := config.Port
+	if port == 0 {
+		port = 443
+	}
+
+	table := schema + `.%s`
+	//the host is always in snowflakecomputing.com domain
+	return &sqlTarget{
+		open: func() (*sql.DB, error) {
+			return sql.Open("snowflake", dsn)
+		},
+		addresses:      []string{hostPort(config.Account+snowflakeHostSuffix, port)},
+		schema:         schema,
+		schemaExists:   `SELECT count(*) FROM information_schema.schemata WHERE schema_name = UPPER(?)`,
+		createTable:    `CREATE TABLE ` + table + ` (id varchar(64))`,
+		insert:         `INSERT INTO ` + table + ` (id) VALUES (?)`,
+		selectInserted: `SELECT id FROM ` + table + ` WHERE id = ?`,
+		dropTable:      `DROP TABLE ` + table,
+	}, nil
+}
+
+//diagnoseSQL run network, auth, schema, create table and insert/read steps. The test table is dropped in the end
+func (d *diagnostics) diagnoseSQL(target *sqlTarget) {
+	d.network(target.addresses)
+	if target.open == nil {
+		return
+	}
+
+	var db *sql.DB
+	d.step(AuthStep, func() (string, error) {
+		var err error
+		if db, err = target.open(); err != nil {
+			return "", err
+		}
+		ctx, cancel := d.timeout()
+		defer cancel()
+		if err := db.PingContext(ctx); err != nil {
+			return "", err
+		}
+		return "Authenticated", nil
+	})
+	if db != nil {
+		defer db.Close()
+	}
+
+	d.step(SchemaStep, func() (string, error) {
+		ctx, cancel := d.timeout()
+		defer cancel()
+		var count int
+		if err := db.QueryRowContext(ctx, target.schemaExists, target.schema).Scan(&count); err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "", fmt.Errorf("Schema [%s] doesn't exist. EventNative creates it on the first event if the user has permission", target.schema)
+		}
+		return fmt.Sprintf("Schema [%s] exists", target.schema), nil
+	})
+
+	tableName := testTableName()
+	created := d.step(CreateTableStep, func() (string, error) {
+		ctx, cancel := d.timeout()
+		defer cancel()
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(target.createTable, tableName)); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Table [%s] has been created", tableName), nil
+	})
+	if created {
+		defer func() {
+			ctx, cancel := d.timeout()
+			defer cancel()
+			db.ExecContext(ctx, fmt.Sprintf(target.dropTable, tableName))
+		}()
+	}
+
+	d.step(InsertReadStep, func() (string, error) {
+		ctx, cancel := d.timeout()
+		defer cancel()
+		id := tableName
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(target.insert, tableName), id); err != nil {
+			return "", fmt.Errorf("Error inserting test row: %v", err)
+		}
+		var readId string
+		if err := db.QueryRowContext(ctx, fmt.Sprintf(target.selectInserted, tableName), id).Scan(&readId); err != nil {
+			return "", fmt.Errorf("Error reading test row: %v", err)
+		}
+		return "Test row has been inserted and read back", nil
+	})
+}
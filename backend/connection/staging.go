@@ -0,0 +1,60 @@
+package connection
+
+import (
+	"fmt"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+//diagnoseStaging write and delete a test file in the staging bucket (S3 or Google Cloud Storage) of batch destinations and file dumps
+func (d *diagnostics) diagnoseStaging(config *enstorages.DestinationConfig) {
+	switch config.Type {
+	case enstorages.RedshiftType, enstorages.SnowflakeType, enstorages.BigQueryType:
+		if config.Mode == enstorages.StreamMode {
+			return
+		}
+	case enstorages.S3Type:
+	default:
+		return
+	}
+
+	fileName := testTableName() + ".txt"
+	if config.S3 != nil {
+		d.independentStep(StagingStep, func() (string, error) {
+			s3, err := enadapters.NewS3(config.S3)
+			if err != nil {
+				return "", err
+			}
+			defer s3.Close()
+			if err := s3.UploadBytes(fileName, []byte("jitsu connection test")); err != nil {
+				return "", fmt.Errorf("Error writing test file: %v", err)
+			}
+			if err := s3.DeleteObject(fileName); err != nil {
+				return "", fmt.Errorf("Error deleting test file: %v", err)
+			}
+			return fmt.Sprintf("Test file has been written to and deleted from S3 bucket [%s]", config.S3.Bucket), nil
+		})
+		return
+	}
+
+	if config.Google != nil && config.Google.Bucket != "" {
+		d.independentStep(StagingStep, func() (string, error) {
+			google := *config.Google
+			if err := google.Validate(false); err != nil {
+				return "", err
+			}
+			gcs, err := enadapters.NewGoogleCloudStorage(d.ctx, &google)
+			if err != nil {
+				return "", err
+			}
+			defer gcs.Close()
+			if err := gcs.UploadBytes(fileName, []byte("jitsu connection test")); err != nil {
+				return "", fmt.Errorf("Error writing test file: %v", err)
+			}
+			if err := gcs.DeleteObject(fileName); err != nil {
+				return "", fmt.Errorf("Error deleting test file: %v", err)
+			}
+			return fmt.Sprintf("Test file has been written to and deleted from Google Cloud Storage bucket [%s]", google.Bucket), nil
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package destinations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+func init() {
+	RegisterMapper(&bigQueryMapper{})
+}
+
+type bigQueryMapper struct{}
+
+func (bqm *bigQueryMapper) Type() string {
+	return enstorages.BigQueryType
+}
+
+func (bqm *bigQueryMapper) FormData() interface{} {
+	return &entities.BigQueryFormData{}
+}
+
+func (bqm *bigQueryMapper) SecretFields() []string {
+	return []string{"bqJSONKey"}
+}
+
+func (bqm *bigQueryMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	bqFormData := formData.(*entities.BigQueryFormData)
+	validateMode(bqFormData.Mode, errs)
+	errs.required("bqProjectId", bqFormData.ProjectId)
+	validateGoogleKey("bqJSONKey", bqFormData.JsonKey, errs)
+
+	//batch mode works via google cloud storage
+	if bqFormData.Mode != enstorages.StreamMode {
+		errs.required("bqGCSBucket", bqFormData.GCSBucket)
+	}
+}
+
+func (bqm *bigQueryMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	bqFormData := formData.(*entities.BigQueryFormData)
+	gcs := &enadapters.GoogleConfig{Project: bqFormData.ProjectId, Bucket: bqFormData.GCSBucket,
+		KeyFile: bqFormData.JsonKey, Dataset: bqFormData.Dataset}
+	return &enstorages.DestinationConfig{
+		Type: enstorages.BigQueryType,
+		Mode: bqFormData.Mode,
+		DataLayout: &enstorages.DataLayout{
+			TableNameTemplate: bqFormData.TableName,
+		},
+		Google: gcs,
+	}, nil
+}
+
+func (bqm *bigQueryMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.Google == nil {
+		return nil, errors.New("google is required")
+	}
+	jsonKey, ok := config.Google.KeyFile.(string)
+	if !ok && config.Google.KeyFile != nil {
+		b, err := json.Marshal(config.Google.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshaling key_file: %v", err)
+		}
+		jsonKey = string(b)
+	}
+	bqFormData := &entities.BigQueryFormData{
+		Mode:      config.Mode,
+		TableName: dataLayout(config).TableNameTemplate,
+		ProjectId: config.Google.Project,
+		Dataset:   config.Google.Dataset,
+		JsonKey:   jsonKey,
+		GCSBucket: config.Google.Bucket,
+	}
+	return bqFormData, nil
+}
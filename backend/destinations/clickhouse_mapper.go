@@ -0,0 +1,171 @@
+package destinations
+
+import (
+	"errors"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"net/url"
+	"strings"
+)
+
+//selfHosted is true if EventNative runs in the same self-hosted installation as the manager. ClickHouse TLS config is
+//CA certificate file paths on EventNative host so it is accepted only in self-hosted installations
+var selfHosted bool
+
+func init() {
+	RegisterMapper(&clickHouseMapper{})
+}
+
+//InitSelfHosted enable settings which refer to files on EventNative host (ClickHouse TLS config)
+func InitSelfHosted(value bool) {
+	selfHosted = value
+}
+
+type clickHouseMapper struct{}
+
+func (chm *clickHouseMapper) Type() string {
+	return enstorages.ClickHouseType
+}
+
+func (chm *clickHouseMapper) FormData() interface{} {
+	return &entities.ClickHouseFormData{}
+}
+
+//SecretFields return DSNs because they contain credentials
+func (chm *clickHouseMapper) SecretFields() []string {
+	return []string{"ch_dsns", "ch_dsns_list", "ch_password"}
+}
+
+func (chm *clickHouseMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	chFormData := formData.(*entities.ClickHouseFormData)
+	validateMode(chFormData.Mode, errs)
+	errs.required("ch_database", chFormData.ChDb)
+
+	field := "ch_dsns_list"
+	dsns := chFormData.ChDsnsList
+	if len(dsns) == 0 && chFormData.ChDsns != "" {
+		field = "ch_dsns"
+		dsns = strings.Split(chFormData.ChDsns, ",")
+	}
+	if len(dsns) == 0 {
+		errs.add(field, "at least one DSN is required")
+		return
+	}
+	for _, dsn := range dsns {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			errs.add(field, "DSN mustn't be empty")
+		} else if !isEncrypted(dsn) && !strings.HasPrefix(dsn, "http") {
+			errs.add(field, "DSNs must have http:// or https:// prefix")
+		} else if !isEncrypted(dsn) && len(chFormData.ChTls) > 0 && !strings.HasPrefix(dsn, "https://") {
+			errs.add(field, "DSNs must have https:// prefix if TLS is configured")
+		}
+	}
+	if len(dsns) > 1 {
+		errs.required("ch_cluster", chFormData.ChCluster)
+	}
+
+	if chFormData.ChPassword != "" && chFormData.ChUser == "" {
+		errs.add("ch_user", "is required if password is set")
+	}
+	if len(chFormData.ChTls) > 0 && !selfHosted {
+		errs.add("ch_tls", "is supported only in self-hosted installations: CA certificate paths refer to files on EventNative server")
+	}
+	for name, caCertPath := range chFormData.ChTls {
+		if name == "" || caCertPath == "" {
+			errs.add("ch_tls", "TLS config name and CA certificate path must be non empty")
+		}
+	}
+}
+
+func (chm *clickHouseMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	chFormData := formData.(*entities.ClickHouseFormData)
+	dsns := chFormData.ChDsnsList
+	if len(dsns) == 0 {
+		dsns = strings.Split(chFormData.ChDsns, ",")
+	}
+	if chFormData.ChUser != "" {
+		var err error
+		if dsns, err = withCredentials(dsns, chFormData.ChUser, chFormData.ChPassword); err != nil {
+			return nil, err
+		}
+	}
+	tlsConfig := chFormData.ChTls
+	if !selfHosted {
+		//stored TLS config isn't served so EventNative doesn't read arbitrary files on its host
+		tlsConfig = nil
+	}
+	return &enstorages.DestinationConfig{
+		Type: enstorages.ClickHouseType,
+		Mode: chFormData.Mode,
+		DataLayout: &enstorages.DataLayout{
+			TableNameTemplate: chFormData.TableName,
+		},
+		ClickHouse: &enadapters.ClickHouseConfig{
+			Dsns:     dsns,
+			Database: chFormData.ChDb,
+			Cluster:  chFormData.ChCluster,
+			Tls:      tlsConfig,
+		},
+	}, nil
+}
+
+func (chm *clickHouseMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.ClickHouse == nil {
+		return nil, errors.New("clickhouse is required")
+	}
+	dsns, user, password := withoutCredentials(config.ClickHouse.Dsns)
+	return &entities.ClickHouseFormData{
+		Mode:       config.Mode,
+		TableName:  dataLayout(config).TableNameTemplate,
+		ChCluster:  config.ClickHouse.Cluster,
+		ChDb:       config.ClickHouse.Database,
+		ChDsnsList: dsns,
+		ChUser:     user,
+		ChPassword: password,
+		ChTls:      config.ClickHouse.Tls,
+	}, nil
+}
+
+//withoutCredentials return DSNs without credentials and the user and the password if all DSNs have the same ones.
+//It is the reverse of withCredentials. Otherwise DSNs are returned as is
+func withoutCredentials(dsns []string) ([]string, string, string) {
+	var user *url.Userinfo
+	result := make([]string, 0, len(dsns))
+	for _, dsn := range dsns {
+		dsnUrl, err := url.Parse(strings.TrimSpace(dsn))
+		if err != nil || dsnUrl.User == nil || (user != nil && dsnUrl.User.String() != user.String()) {
+			return dsns, "", ""
+		}
+		user = dsnUrl.User
+		dsnUrl.User = nil
+		result = append(result, dsnUrl.String())
+	}
+	if user == nil {
+		return dsns, "", ""
+	}
+	password, _ := user.Password()
+	return result, user.Username(), password
+}
+
+//withCredentials return DSNs with the user and the password. DSNs which already have credentials aren't changed
+func withCredentials(dsns []string, user, password string) ([]string, error) {
+	result := make([]string, 0, len(dsns))
+	for _, dsn := range dsns {
+		dsnUrl, err := url.Parse(strings.TrimSpace(dsn))
+		if err != nil {
+			//parsing error isn't returned because it contains the DSN with credentials
+			return nil, errors.New("Error parsing ClickHouse DSN: malformed URL")
+		}
+		if dsnUrl.User == nil {
+			if password != "" {
+				dsnUrl.User = url.UserPassword(user, password)
+			} else {
+				dsnUrl.User = url.User(user)
+			}
+		}
+		result = append(result, dsnUrl.String())
+	}
+	return result, nil
+}
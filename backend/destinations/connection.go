@@ -0,0 +1,94 @@
+package destinations
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	sslModeParameter        = "sslmode"
+	connectTimeoutParameter = "connect_timeout"
+)
+
+var (
+	sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+	connectionParameterName = regexp.MustCompile(`^[a-z_]+$`)
+)
+
+//connectionParameters return Postgres (Redshift) DataSourceConfig.Parameters of form data connection settings. Return nil if nothing is set
+func connectionParameters(sslMode string, connectTimeout int, other map[string]string) map[string]string {
+	parameters := map[string]string{}
+	for name, value := range other {
+		parameters[name] = value
+	}
+	if sslMode != "" {
+		parameters[sslModeParameter] = sslMode
+	}
+	if connectTimeout > 0 {
+		parameters[connectTimeoutParameter] = strconv.Itoa(connectTimeout)
+	}
+
+	if len(parameters) == 0 {
+		return nil
+	}
+	return parameters
+}
+
+//splitConnectionParameters is the reverse of connectionParameters
+func splitConnectionParameters(parameters map[string]string) (string, int, map[string]string) {
+	var sslMode string
+	var connectTimeout int
+	var other map[string]string
+	for name, value := range parameters {
+		switch name {
+		case sslModeParameter:
+			sslMode = value
+			continue
+		case connectTimeoutParameter:
+			if timeout, err := strconv.Atoi(value); err == nil && timeout > 0 {
+				connectTimeout = timeout
+				continue
+			}
+		}
+
+		if other == nil {
+			other = map[string]string{}
+		}
+		other[name] = value
+	}
+	return sslMode, connectTimeout, other
+}
+
+//validateConnectionParameters check connection settings. EventNative concatenates parameters into a connection string
+//as is so values mustn't contain spaces and quotes
+func validateConnectionParameters(sslModeField, sslMode, timeoutField string, connectTimeout int, parametersField string, other map[string]string, errs *ValidationErrors) {
+	if sslMode != "" && !containsString(sslModes, sslMode) {
+		errs.add(sslModeField, "must be one of: "+strings.Join(sslModes, ", "))
+	}
+	if connectTimeout < 0 {
+		errs.add(timeoutField, "mustn't be negative")
+	}
+	for name, value := range other {
+		if !connectionParameterName.MatchString(name) {
+			errs.add(parametersField, fmt.Sprintf("parameter name [%s] must contain only lower case letters and '_'", name))
+		}
+		if name == sslModeParameter || name == connectTimeoutParameter {
+			errs.add(parametersField, fmt.Sprintf("parameter [%s] must be set with %s or %s field", name, sslModeField, timeoutField))
+		}
+		if value == "" || strings.ContainsAny(value, " '\\") {
+			errs.add(parametersField, fmt.Sprintf("parameter [%s] value must be non empty and mustn't contain spaces, quotes or backslashes", name))
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package destinations
+
+import (
+	"fmt"
+	"github.com/jitsucom/eventnative/events"
+	"github.com/jitsucom/eventnative/schema"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"github.com/jitsucom/eventnative/typing"
+	"sort"
+)
+
+//eventnative uses it if table name template isn't set
+const defaultTableName = "events"
+
+//DryRunColumn is a column of the mapped event row. Type is sql type cast or the value type
+type DryRunColumn struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+//DryRunEvent is the result of applying destination mapping rules and table name template to one event.
+//Skipped is true if table name template returns empty string (eventnative skips such events)
+type DryRunEvent struct {
+	EventId string          `json:"eventId,omitempty"`
+	Table   string          `json:"table,omitempty"`
+	Columns []*DryRunColumn `json:"columns,omitempty"`
+	Skipped bool            `json:"skipped,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+//DryRun apply config mapping rules and table name template to events the same way as eventnative does.
+//Errors are returned per event in DryRunEvent.Error. Error is returned only if the config is invalid
+func DryRun(config *enstorages.DestinationConfig, objects []map[string]interface{}) ([]*DryRunEvent, error) {
+	layout := dataLayout(config)
+	tableNameTemplate := layout.TableNameTemplate
+	if tableNameTemplate == "" {
+		tableNameTemplate = defaultTableName
+	}
+
+	fieldMapper, sqlTypeCasts, err := schema.NewFieldMapper(layout.MappingType, layout.Mapping, layout.Mappings)
+	if err != nil {
+		return nil, err
+	}
+	processor, err := schema.NewProcessor("dry_run", tableNameTemplate, fieldMapper, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*DryRunEvent
+	for _, object := range objects {
+		dryRunEvent := &DryRunEvent{EventId: events.ExtractEventId(object)}
+		result = append(result, dryRunEvent)
+
+		batchHeader, row, err := processor.ProcessEvent(object)
+		if err == schema.ErrSkipObject {
+			dryRunEvent.Skipped = true
+			continue
+		}
+		if err != nil {
+			dryRunEvent.Error = err.Error()
+			continue
+		}
+		dryRunEvent.Table = batchHeader.TableName
+
+		for name, value := range row {
+			columnType, ok := sqlTypeCasts[name]
+			if !ok {
+				dataType, err := typing.TypeFromValue(value)
+				if err != nil {
+					dryRunEvent.Error = fmt.Sprintf("Error getting type of field [%s]: %v", name, err)
+					break
+				}
+				columnType = dataType.String()
+			}
+			dryRunEvent.Columns = append(dryRunEvent.Columns, &DryRunColumn{Name: name, Type: columnType, Value: value})
+		}
+		sort.Slice(dryRunEvent.Columns, func(i, j int) bool {
+			return dryRunEvent.Columns[i].Name < dryRunEvent.Columns[j].Name
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package destinations
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"strings"
+)
+
+//FileDumpType writes batched JSON event files into S3 with eventnative s3 destination. Files are put into the folder
+//with names generated by eventnative: eventnative s3 destination doesn't support file name templates, CSV or Google Cloud Storage
+const FileDumpType = "file_dump"
+
+func init() {
+	RegisterMapper(&fileDumpMapper{})
+}
+
+type fileDumpMapper struct{}
+
+func (fdm *fileDumpMapper) Type() string {
+	return FileDumpType
+}
+
+func (fdm *fileDumpMapper) FormData() interface{} {
+	return &entities.FileDumpFormData{}
+}
+
+func (fdm *fileDumpMapper) SecretFields() []string {
+	return []string{"dumpS3SecretKey"}
+}
+
+func (fdm *fileDumpMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	dumpFormData := formData.(*entities.FileDumpFormData)
+	if dumpFormData.Mode == enstorages.StreamMode {
+		errs.add("mode", fmt.Sprintf("file dump supports only %s mode", enstorages.BatchMode))
+	} else {
+		validateMode(dumpFormData.Mode, errs)
+	}
+
+	switch {
+	case dumpFormData.UseHostedS3 && dumpFormData.S3Bucket != "":
+		errs.add("dumpS3Bucket", "only one of hosted S3 or S3 might be configured")
+	case dumpFormData.S3Bucket != "":
+		errs.required("dumpS3Region", dumpFormData.S3Region)
+		errs.required("dumpS3AccessKey", dumpFormData.S3AccessKey)
+		errs.required("dumpS3SecretKey", dumpFormData.S3SecretKey)
+	case !dumpFormData.UseHostedS3:
+		errs.add("dumpS3Bucket", "hosted S3 or S3 bucket is required")
+	}
+
+	if strings.Contains(dumpFormData.Folder, "{{") {
+		errs.add("dumpFolder", "must be a plain path: eventnative doesn't support folder templates")
+	}
+}
+
+//Map return eventnative s3 config. Hosted S3 files are put into the destination id folder so destinations don't share files
+func (fdm *fileDumpMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	dumpFormData := formData.(*entities.FileDumpFormData)
+	folder := strings.Trim(dumpFormData.Folder, "/")
+	config := &enstorages.DestinationConfig{
+		Type: enstorages.S3Type,
+		Mode: enstorages.BatchMode,
+	}
+	if dumpFormData.UseHostedS3 {
+		if defaultS3 == nil {
+			return nil, errors.New("hosted S3 isn't configured")
+		}
+		config.S3 = &enadapters.S3Config{
+			AccessKeyID: defaultS3.AccessKeyID,
+			SecretKey:   defaultS3.SecretKey,
+			Bucket:      defaultS3.Bucket,
+			Region:      defaultS3.Region,
+			Endpoint:    defaultS3.Endpoint,
+			Folder:      joinFolder(destinationId, folder),
+		}
+	} else {
+		config.S3 = &enadapters.S3Config{
+			AccessKeyID: dumpFormData.S3AccessKey,
+			SecretKey:   dumpFormData.S3SecretKey,
+			Bucket:      dumpFormData.S3Bucket,
+			Region:      dumpFormData.S3Region,
+			Endpoint:    dumpFormData.S3Endpoint,
+			Folder:      folder,
+		}
+	}
+	return config, nil
+}
+
+//joinFolder return non empty folders joined with /
+func joinFolder(folders ...string) string {
+	var parts []string
+	for _, folder := range folders {
+		if folder != "" {
+			parts = append(parts, folder)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+//Unmap return form data of eventnative s3 config. Hosted S3 folder is <destination id>[/<folder>]
+func (fdm *fileDumpMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.S3 == nil {
+		return nil, errors.New("s3 is required")
+	}
+
+	dumpFormData := &entities.FileDumpFormData{Mode: config.Mode}
+	if isHostedS3(config.S3, defaultS3) {
+		dumpFormData.UseHostedS3 = true
+		if i := strings.Index(config.S3.Folder, "/"); i >= 0 {
+			dumpFormData.Folder = config.S3.Folder[i+1:]
+		}
+		return dumpFormData, nil
+	}
+
+	dumpFormData.S3Region = config.S3.Region
+	dumpFormData.S3Bucket = config.S3.Bucket
+	dumpFormData.S3Endpoint = config.S3.Endpoint
+	dumpFormData.S3AccessKey = config.S3.AccessKeyID
+	dumpFormData.S3SecretKey = config.S3.SecretKey
+	dumpFormData.Folder = config.S3.Folder
+	return dumpFormData, nil
+}
@@ -0,0 +1,77 @@
+package destinations
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"strings"
+	"testing"
+)
+
+var testDefaultS3 = &enadapters.S3Config{AccessKeyID: "hosted-key", SecretKey: "hosted-secret", Bucket: "hosted-bucket", Region: "us-east-1"}
+
+func TestFileDumpMapFolder(t *testing.T) {
+	tests := []struct {
+		name           string
+		formData       *entities.FileDumpFormData
+		expectedBucket string
+		expectedFolder string
+	}{
+		{"user bucket", &entities.FileDumpFormData{S3Bucket: "b", S3Region: "r", S3AccessKey: "k", S3SecretKey: "s", Folder: "/events/raw/"}, "b", "events/raw"},
+		{"user bucket root", &entities.FileDumpFormData{S3Bucket: "b", S3Region: "r", S3AccessKey: "k", S3SecretKey: "s"}, "b", ""},
+		{"hosted", &entities.FileDumpFormData{UseHostedS3: true, Folder: "events"}, "hosted-bucket", "project.uid/events"},
+		{"hosted root", &entities.FileDumpFormData{UseHostedS3: true}, "hosted-bucket", "project.uid"},
+	}
+	mapper := &fileDumpMapper{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs ValidationErrors
+			mapper.Validate(tt.formData, &errs)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected validation errors: %v", errs)
+			}
+
+			config, err := mapper.Map("project.uid", tt.formData, testDefaultS3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Type != enstorages.S3Type || config.S3.Bucket != tt.expectedBucket || config.S3.Folder != tt.expectedFolder {
+				t.Errorf("unexpected config: type %s bucket %s folder %s", config.Type, config.S3.Bucket, config.S3.Folder)
+			}
+
+			unmapped, err := mapper.Unmap(config, testDefaultS3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formData := unmapped.(*entities.FileDumpFormData)
+			expectedFolder := strings.Trim(tt.formData.Folder, "/")
+			if formData.UseHostedS3 != tt.formData.UseHostedS3 || formData.S3Bucket != tt.formData.S3Bucket || formData.Folder != expectedFolder {
+				t.Errorf("Unmap doesn't mirror Map: %+v", formData)
+			}
+		})
+	}
+}
+
+func TestFileDumpValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		formData *entities.FileDumpFormData
+	}{
+		{"no bucket", "dumpS3Bucket", &entities.FileDumpFormData{Folder: "events"}},
+		{"hosted and own bucket", "dumpS3Bucket", &entities.FileDumpFormData{UseHostedS3: true, S3Bucket: "b"}},
+		{"no credentials", "dumpS3AccessKey", &entities.FileDumpFormData{S3Bucket: "b", S3Region: "r", S3SecretKey: "s"}},
+		{"stream mode", "mode", &entities.FileDumpFormData{UseHostedS3: true, Mode: enstorages.StreamMode}},
+		{"folder template", "dumpFolder", &entities.FileDumpFormData{UseHostedS3: true, Folder: "{{.Date}}"}},
+	}
+	mapper := &fileDumpMapper{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs ValidationErrors
+			mapper.Validate(tt.formData, &errs)
+			if !hasFieldError(errs, tt.field) {
+				t.Errorf("expected %s error, got %v", tt.field, errs)
+			}
+		})
+	}
+}
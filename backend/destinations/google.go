@@ -0,0 +1,29 @@
+package destinations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/option"
+	"strings"
+)
+
+//GoogleCredentials return credentials option of google key_file: JSON object, JSON string or a file path
+func GoogleCredentials(keyFile interface{}) (option.ClientOption, error) {
+	switch key := keyFile.(type) {
+	case map[string]interface{}:
+		b, err := json.Marshal(key)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed google key_file: %v", err)
+		}
+		return option.WithCredentialsJSON(b), nil
+	case string:
+		if strings.Contains(key, "{") {
+			return option.WithCredentialsJSON([]byte(key)), nil
+		}
+		if key != "" {
+			return option.WithCredentialsFile(key), nil
+		}
+	}
+	return nil, errors.New("google key_file is required and must be a JSON object, JSON string or a file path")
+}
@@ -0,0 +1,60 @@
+package destinations
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+func init() {
+	RegisterMapper(&googleAnalyticsMapper{})
+}
+
+type googleAnalyticsMapper struct{}
+
+func (gam *googleAnalyticsMapper) Type() string {
+	return enstorages.GoogleAnalyticsType
+}
+
+func (gam *googleAnalyticsMapper) FormData() interface{} {
+	return &entities.GoogleAnalyticsFormData{}
+}
+
+func (gam *googleAnalyticsMapper) SecretFields() []string {
+	return nil
+}
+
+func (gam *googleAnalyticsMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	gaFormData := formData.(*entities.GoogleAnalyticsFormData)
+	if gaFormData.Mode != enstorages.StreamMode {
+		errs.add("mode", fmt.Sprintf("Google Analytics supports only %s mode", enstorages.StreamMode))
+	}
+	errs.required("gaTrackingId", gaFormData.TrackingId)
+}
+
+func (gam *googleAnalyticsMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	gaFormData := formData.(*entities.GoogleAnalyticsFormData)
+	return &enstorages.DestinationConfig{
+		Type: enstorages.GoogleAnalyticsType,
+		Mode: gaFormData.Mode,
+		DataLayout: &enstorages.DataLayout{
+			TableNameTemplate: gaFormData.TableName,
+		},
+		GoogleAnalytics: &enadapters.GoogleAnalyticsConfig{
+			TrackingId: gaFormData.TrackingId,
+		},
+	}, nil
+}
+
+func (gam *googleAnalyticsMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.GoogleAnalytics == nil {
+		return nil, errors.New("google_analytics is required")
+	}
+	return &entities.GoogleAnalyticsFormData{
+		Mode:       config.Mode,
+		TableName:  dataLayout(config).TableNameTemplate,
+		TrackingId: config.GoogleAnalytics.TrackingId,
+	}, nil
+}
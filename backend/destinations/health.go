@@ -0,0 +1,83 @@
+package destinations
+
+import (
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/notifications"
+	"sync"
+	"time"
+)
+
+//DestinationStatus is a result of serving the destination to EventNative. Unhealthy and disabled destinations are skipped from the payload
+type DestinationStatus struct {
+	Uid      string    `json:"uid"`
+	Id       string    `json:"id"`
+	Type     string    `json:"type"`
+	Healthy  bool      `json:"healthy"`
+	Disabled bool      `json:"disabled,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+	Since    time.Time `json:"since"`
+}
+
+//ProjectStatus is a status of all project destinations from the last destinations payload build
+type ProjectStatus struct {
+	CheckedAt    time.Time            `json:"checkedAt"`
+	Destinations []*DestinationStatus `json:"destinations"`
+}
+
+//Health keeps destinations statuses per project. If notify is true a Slack notification is sent when
+//a previously healthy destination starts being skipped
+type Health struct {
+	sync.RWMutex
+
+	notify   bool
+	projects map[string]*ProjectStatus
+}
+
+func NewHealth(notify bool) *Health {
+	return &Health{notify: notify, projects: map[string]*ProjectStatus{}}
+}
+
+//Update replace all projects statuses with the statuses of the last payload build. Since is kept if the status isn't changed
+func (h *Health) Update(statuses map[string][]*DestinationStatus) {
+	h.Lock()
+	defer h.Unlock()
+
+	now := time.Now().UTC()
+	projects := map[string]*ProjectStatus{}
+	for projectId, projectStatuses := range statuses {
+		previous := map[string]*DestinationStatus{}
+		if previousProject, ok := h.projects[projectId]; ok {
+			for _, status := range previousProject.Destinations {
+				previous[status.Uid] = status
+			}
+		}
+
+		for _, status := range projectStatuses {
+			status.Since = now
+			previousStatus, ok := previous[status.Uid]
+			if !ok {
+				continue
+			}
+			if previousStatus.Healthy == status.Healthy && previousStatus.Disabled == status.Disabled {
+				status.Since = previousStatus.Since
+				continue
+			}
+			if previousStatus.Healthy && !status.Healthy {
+				logging.Warnf("Destination [%s] of [%s] project is skipped: %s", status.Uid, projectId, status.Reason)
+				if h.notify {
+					notifications.SystemErrorf("Destination [%s] (%s) of project [%s] isn't served to EventNative anymore: %s", status.Id, status.Type, projectId, status.Reason)
+				}
+			}
+		}
+		projects[projectId] = &ProjectStatus{CheckedAt: now, Destinations: projectStatuses}
+	}
+	h.projects = projects
+}
+
+//Get return project destinations statuses or nil if the project doesn't have destinations
+func (h *Health) Get(projectId string) *ProjectStatus {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.projects[projectId]
+}
@@ -0,0 +1,197 @@
+package destinations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	"github.com/jitsucom/eventnative/schema"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"strings"
+)
+
+//UnmapConfig return destination entity of eventnative destination config. It is the reverse of MapConfig and is used for
+//importing eventnative YAML configuration. Returned destination doesn't have _uid
+func UnmapConfig(destinationId string, config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (*entities.Destination, error) {
+	configType := config.Type
+	if configType == "" {
+		//eventnative uses destination name as type if it isn't set
+		configType = destinationId
+	}
+	mapper, ok := mapperByConfigType(configType)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported destination type: %s", configType)
+	}
+
+	formData, err := mapper.Unmap(config, defaultS3)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(formData)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling %s form data: %v", mapper.Type(), err)
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling %s form data: %v", mapper.Type(), err)
+	}
+
+	mappings, err := unmapMappings(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Destination{
+		Id:       destinationId,
+		Type:     mapper.Type(),
+		Data:     data,
+		Mappings: mappings,
+		OnlyKeys: config.OnlyTokens,
+	}, nil
+}
+
+//SameDestination return true if destinations have the same type, form data, mapping rules and API keys.
+//Form data is compared with decrypted secrets and without absent/zero value differences
+func SameDestination(first, second *entities.Destination) bool {
+	if first.Type != second.Type || first.Id != second.Id {
+		return false
+	}
+	mapper, ok := mappers[first.Type]
+	if !ok {
+		return false
+	}
+
+	var normalized [][]byte
+	for _, destination := range []*entities.Destination{first, second} {
+		destination, err := decryptSecrets(destination)
+		if err != nil {
+			return false
+		}
+		formData := mapper.FormData()
+		if err := unmarshalFormData(destination, formData); err != nil {
+			return false
+		}
+		b, err := json.Marshal([]interface{}{formData, destination.Mappings, destination.OnlyKeys})
+		if err != nil {
+			return false
+		}
+		normalized = append(normalized, b)
+	}
+	return bytes.Equal(normalized[0], normalized[1])
+}
+
+//mapperByConfigType return mapper of eventnative config type
+func mapperByConfigType(configType string) (DestinationMapper, bool) {
+	switch configType {
+	case enstorages.S3Type:
+		configType = FileDumpType
+	}
+	mapper, ok := mappers[configType]
+	return mapper, ok
+}
+
+//dataLayout return config data layout or an empty one
+func dataLayout(config *enstorages.DestinationConfig) *enstorages.DataLayout {
+	if config.DataLayout == nil {
+		return &enstorages.DataLayout{}
+	}
+	return config.DataLayout
+}
+
+//isHostedS3 return true if S3 config is the manager hosted S3
+func isHostedS3(s3, defaultS3 *enadapters.S3Config) bool {
+	return s3 != nil && defaultS3 != nil && defaultS3.Bucket != "" && s3.Bucket == defaultS3.Bucket && s3.AccessKeyID == defaultS3.AccessKeyID
+}
+
+//unmapMappings return mapping rules of eventnative data layout (both new style mappings and old style mapping strings)
+func unmapMappings(config *enstorages.DestinationConfig) (entities.Mappings, error) {
+	layout := dataLayout(config)
+	result := entities.Mappings{KeepFields: true}
+
+	if layout.Mappings != nil && len(layout.Mappings.Fields) > 0 {
+		if layout.Mappings.KeepUnmapped != nil {
+			result.KeepFields = *layout.Mappings.KeepUnmapped
+		}
+		for _, field := range layout.Mappings.Fields {
+			rule := entities.MapRule{SourceField: field.Src, DestinationField: field.Dst}
+			switch field.Action {
+			case schema.MOVE, schema.CAST:
+				action, err := unmapCast(field.Type)
+				if err != nil {
+					return result, err
+				}
+				if action == MoveAction && field.Action == schema.CAST {
+					return result, fmt.Errorf("Mapping rule [%s] must have type", field.String())
+				}
+				rule.Action = action
+			case schema.REMOVE:
+				rule.Action = EraseAction
+				rule.DestinationField = ""
+			case schema.CONSTANT:
+				rule.Action = ConstantAction
+				rule.SourceField = ""
+				rule.Value = field.Value
+			default:
+				return result, fmt.Errorf("Unknown mapping action: %s", field.Action)
+			}
+			result.Rules = append(result.Rules, rule)
+		}
+	} else if len(layout.Mapping) > 0 {
+		result.KeepFields = layout.MappingType != schema.Strict
+		for _, mapping := range layout.Mapping {
+			rule, err := unmapMappingString(mapping)
+			if err != nil {
+				return result, err
+			}
+			result.Rules = append(result.Rules, rule)
+		}
+	}
+
+	if len(result.Rules) == 0 {
+		return entities.Mappings{}, nil
+	}
+	return result, nil
+}
+
+//unmapMappingString parse old style eventnative mapping: /src -> /dst, /src -> (type) /dst or /src ->
+func unmapMappingString(mapping string) (entities.MapRule, error) {
+	parts := strings.Split(strings.ReplaceAll(mapping, " ", ""), "->")
+	if len(parts) != 2 || parts[0] == "" {
+		return entities.MapRule{}, fmt.Errorf("Malformed mapping [%s]", mapping)
+	}
+	rule := entities.MapRule{SourceField: parts[0], DestinationField: parts[1]}
+	if rule.DestinationField == "" {
+		rule.Action = EraseAction
+		return rule, nil
+	}
+
+	castType := ""
+	if strings.HasPrefix(rule.DestinationField, "(") {
+		closing := strings.Index(rule.DestinationField, ")")
+		if closing < 0 {
+			return entities.MapRule{}, fmt.Errorf("Malformed cast in mapping [%s]", mapping)
+		}
+		castType = rule.DestinationField[1:closing]
+		rule.DestinationField = rule.DestinationField[closing+1:]
+	}
+	action, err := unmapCast(castType)
+	if err != nil {
+		return entities.MapRule{}, err
+	}
+	rule.Action = action
+	return rule, nil
+}
+
+//unmapCast return cast action of sql type or move action if the type is empty
+func unmapCast(sqlType string) (string, error) {
+	if sqlType == "" {
+		return MoveAction, nil
+	}
+	for action, castType := range castActions {
+		if strings.EqualFold(castType, sqlType) {
+			return action, nil
+		}
+	}
+	return "", fmt.Errorf("Cast to sql type [%s] isn't supported", sqlType)
+}
@@ -0,0 +1,120 @@
+package destinations
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+//DestinationMapper is a destination type: it owns the type form data struct, its validation and mapping into eventnative config.
+//Every mapper registers itself with RegisterMapper
+type DestinationMapper interface {
+	//Type return eventnative destination type
+	Type() string
+	//FormData return a new empty form data struct pointer
+	FormData() interface{}
+	//SecretFields return json names of form data fields which are stored encrypted
+	SecretFields() []string
+	//Validate append form data errors. Secrets might be encrypted so their format mustn't be checked
+	Validate(formData interface{}, errs *ValidationErrors)
+	//Map return eventnative config of decrypted form data
+	Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error)
+	//Unmap return form data of eventnative config. It is the reverse of Map
+	Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error)
+}
+
+//FieldSchema is a description of form data field
+type FieldSchema struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+//TypeSchema is a description of destination type form data
+type TypeSchema struct {
+	Type   string         `json:"type"`
+	Fields []*FieldSchema `json:"fields"`
+}
+
+//type:mapper
+var mappers = map[string]DestinationMapper{}
+
+//RegisterMapper add destination type. It must be called once per type (from init)
+func RegisterMapper(mapper DestinationMapper) {
+	if _, ok := mappers[mapper.Type()]; ok {
+		panic(fmt.Sprintf("Destination mapper of type [%s] is already registered", mapper.Type()))
+	}
+	mappers[mapper.Type()] = mapper
+}
+
+//Types return schemas of all registered destination types ordered by type
+func Types() []*TypeSchema {
+	var result []*TypeSchema
+	for destinationType, mapper := range mappers {
+		secrets := map[string]bool{}
+		for _, field := range mapper.SecretFields() {
+			secrets[field] = true
+		}
+
+		schema := &TypeSchema{Type: destinationType, Fields: []*FieldSchema{}}
+		formDataType := reflect.TypeOf(mapper.FormData()).Elem()
+		for i := 0; i < formDataType.NumField(); i++ {
+			field := formDataType.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			schema.Fields = append(schema.Fields, &FieldSchema{Name: name, Type: schemaType(field.Type), Secret: secrets[name]})
+		}
+		result = append(result, schema)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+//secretFields return json names of the destination type secret fields
+func secretFields(destinationType string) []string {
+	mapper, ok := mappers[destinationType]
+	if !ok {
+		return nil
+	}
+	return mapper.SecretFields()
+}
+
+//unmarshalFormData fill form data struct from destination form data
+func unmarshalFormData(destination *entities.Destination, formData interface{}) error {
+	b, err := json.Marshal(destination.Data)
+	if err != nil {
+		return fmt.Errorf("Error marshaling %s config destination: %v", destination.Type, err)
+	}
+
+	if err := json.Unmarshal(b, formData); err != nil {
+		return fmt.Errorf("Error unmarshaling %s form data: %v", destination.Type, err)
+	}
+	return nil
+}
+
+func schemaType(fieldType reflect.Type) string {
+	switch fieldType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		return "array"
+	case reflect.Interface:
+		return "any"
+	default:
+		return "object"
+	}
+}
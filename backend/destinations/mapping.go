@@ -0,0 +1,191 @@
+package destinations
+
+import (
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/schema"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"regexp"
+	"strings"
+)
+
+//mapping rule actions
+const (
+	MoveAction     = "move"
+	EraseAction    = "erase"
+	ConstantAction = "constant"
+	FlattenAction  = "flatten"
+
+	castActionPrefix = "cast/"
+	jsonCastAction   = "cast/json"
+)
+
+//castActions are mapped into eventnative move rules with sql type. eventnative converts the types into destination sql types
+//except json which is put into DDL as is (see castType)
+var castActions = map[string]string{
+	"cast/int":    "integer",
+	"cast/double": "double",
+	"cast/date":   "timestamp",
+	"cast/string": "string",
+	"cast/bool":   "boolean",
+	"cast/json":   "json",
+}
+
+//unsupportedActions can't be run by eventnative mapping. Rules with them are rejected on create and update instead of being
+//downgraded to move (e.g. hash rule would write the raw PII value into the warehouse)
+var unsupportedActions = map[string]bool{
+	"lower": true,
+	"upper": true,
+	"hash":  true,
+}
+
+//oldStyleCasts are casts which eventnative old style mapping strings support: /src -> (type) /dst
+var oldStyleCasts = map[string]string{
+	"cast/int":    "integer",
+	"cast/double": "double",
+	"cast/date":   "timestamp",
+	"cast/string": "string",
+}
+
+//field path is /-separated list of non empty segments: /key1/key2
+var fieldPathSegment = regexp.MustCompile(`^[A-Za-z0-9_$@.-]+$`)
+
+//castType return eventnative sql type of the cast action for the destination type. Only Postgres has json sql type:
+//other destinations keep JSON values (eventnative serializes arrays into JSON) in string columns
+func castType(destinationType, action string) string {
+	if action == jsonCastAction && destinationType != enstorages.PostgresType {
+		return castActions["cast/string"]
+	}
+	return castActions[action]
+}
+
+//validateMappings append errors of unknown actions, invalid field paths and absent rule parameters.
+//It is called on create and update only: stored rules are mapped permissively (see mappableRules)
+func validateMappings(mappings entities.Mappings, errs *ValidationErrors) {
+	for i, rule := range mappings.Rules {
+		field := fmt.Sprintf("_mappings.%d", i)
+		switch {
+		case rule.Action == MoveAction:
+			validateFieldPath(field+"._srcField", rule.SourceField, errs)
+			validateFieldPath(field+"._dstField", rule.DestinationField, errs)
+		case rule.Action == EraseAction:
+			validateFieldPath(field+"._srcField", rule.SourceField, errs)
+		case rule.Action == ConstantAction:
+			validateFieldPath(field+"._dstField", rule.DestinationField, errs)
+			if rule.Value == nil {
+				errs.add(field+"._value", "is required")
+			}
+		case rule.Action == FlattenAction || castActions[rule.Action] != "":
+			//destination field is optional: the source field is changed in place
+			validateFieldPath(field+"._srcField", rule.SourceField, errs)
+			if rule.DestinationField != "" {
+				validateFieldPath(field+"._dstField", rule.DestinationField, errs)
+			}
+		case unsupportedActions[rule.Action]:
+			errs.add(field+"._action", fmt.Sprintf("Mapping action %s isn't supported by EventNative yet", rule.Action))
+		case strings.HasPrefix(rule.Action, castActionPrefix):
+			errs.add(field+"._action", fmt.Sprintf("Unknown cast type: %s", strings.TrimPrefix(rule.Action, castActionPrefix)))
+		default:
+			errs.add(field+"._action", fmt.Sprintf("Unknown mapping action: %s", rule.Action))
+		}
+	}
+}
+
+func validateFieldPath(field, path string, errs *ValidationErrors) {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		errs.add(field, "is required")
+		return
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if !fieldPathSegment.MatchString(segment) {
+			errs.add(field, fmt.Sprintf("invalid field path [%s]: use /key1/key2 format with letters, digits, '_', '-', '.', '$' or '@'", path))
+			return
+		}
+	}
+}
+
+//mappableRules return stored rules which eventnative can run. Destinations stored before strict validation must be served
+//anyway: field paths aren't checked, rules without required fields are skipped and rules with unknown or unsupported actions
+//erase the source field instead of writing it as is
+func mappableRules(destinationId string, mappings entities.Mappings) entities.Mappings {
+	result := entities.Mappings{KeepFields: mappings.KeepFields}
+	for _, rule := range mappings.Rules {
+		var ok bool
+		switch {
+		case rule.Action == MoveAction:
+			ok = rule.SourceField != "" && rule.DestinationField != ""
+		case rule.Action == ConstantAction:
+			ok = rule.DestinationField != ""
+		case rule.Action == EraseAction || rule.Action == FlattenAction || castActions[rule.Action] != "":
+			ok = rule.SourceField != ""
+		case rule.SourceField != "":
+			logging.Warnf("Destination [%s] mapping rule with unknown or unsupported action [%s] erases [%s] field", destinationId, rule.Action, rule.SourceField)
+			rule = entities.MapRule{Action: EraseAction, SourceField: rule.SourceField}
+			ok = true
+		}
+		if !ok {
+			logging.Warnf("Destination [%s] mapping rule %+v is skipped: required fields are empty", destinationId, rule)
+			continue
+		}
+		result.Rules = append(result.Rules, rule)
+	}
+	return result
+}
+
+//mapMappings return eventnative new style mapping of the destination mapping rules. Rules must be mappable
+func mapMappings(destinationType string, mappings entities.Mappings) *schema.Mapping {
+	keepUnmapped := mappings.KeepFields
+	result := &schema.Mapping{KeepUnmapped: &keepUnmapped}
+	for _, rule := range mappings.Rules {
+		switch rule.Action {
+		case MoveAction:
+			result.Fields = append(result.Fields, schema.MappingField{Src: rule.SourceField, Dst: rule.DestinationField, Action: schema.MOVE})
+		case EraseAction:
+			result.Fields = append(result.Fields, schema.MappingField{Src: rule.SourceField, Action: schema.REMOVE})
+		case ConstantAction:
+			result.Fields = append(result.Fields, schema.MappingField{Dst: rule.DestinationField, Action: schema.CONSTANT, Value: rule.Value})
+		case FlattenAction:
+			//eventnative flattens nested objects into key1_key2 columns
+			dst := rule.DestinationField
+			if dst == "" {
+				dst = "/" + strings.ReplaceAll(strings.Trim(rule.SourceField, "/"), "/", "_")
+			}
+			result.Fields = append(result.Fields, schema.MappingField{Src: rule.SourceField, Dst: dst, Action: schema.MOVE})
+		default:
+			dst := rule.DestinationField
+			if dst == "" {
+				dst = rule.SourceField
+			}
+			//move is required even if dst is src: unmapped fields might be removed
+			result.Fields = append(result.Fields, schema.MappingField{Src: rule.SourceField, Dst: dst, Action: schema.MOVE, Type: castType(destinationType, rule.Action)})
+		}
+	}
+	return result
+}
+
+//mapOldStyleMappings return eventnative old style mapping strings and mapping type if all rules are expressible with them:
+//move and erase rules and casts with destination fields. Destinations created before new style mappings keep the same config.
+//Return false if new style mapping is required
+func mapOldStyleMappings(mappings entities.Mappings) ([]string, schema.FieldMappingType, bool) {
+	var result []string
+	for _, rule := range mappings.Rules {
+		switch {
+		case rule.Action == MoveAction && rule.DestinationField != "":
+			result = append(result, rule.SourceField+" -> "+rule.DestinationField)
+		case rule.Action == EraseAction:
+			result = append(result, rule.SourceField+" -> ")
+		case oldStyleCasts[rule.Action] != "" && rule.DestinationField != "":
+			result = append(result, rule.SourceField+" -> ("+oldStyleCasts[rule.Action]+") "+rule.DestinationField)
+		default:
+			return nil, "", false
+		}
+	}
+
+	mappingType := schema.Default
+	if !mappings.KeepFields {
+		mappingType = schema.Strict
+	}
+	return result, mappingType, true
+}
@@ -0,0 +1,138 @@
+package destinations
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/eventnative/schema"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMappings(t *testing.T) {
+	tests := []struct {
+		name          string
+		rule          entities.MapRule
+		expectedField string
+	}{
+		{"move", entities.MapRule{Action: MoveAction, SourceField: "/a/b", DestinationField: "/c"}, ""},
+		{"cast in place", entities.MapRule{Action: "cast/int", SourceField: "/a"}, ""},
+		{"constant", entities.MapRule{Action: ConstantAction, DestinationField: "/c", Value: 1}, ""},
+		{"constant without value", entities.MapRule{Action: ConstantAction, DestinationField: "/c"}, "_mappings.0._value"},
+		{"move without destination", entities.MapRule{Action: MoveAction, SourceField: "/a"}, "_mappings.0._dstField"},
+		{"invalid path", entities.MapRule{Action: EraseAction, SourceField: "/a b"}, "_mappings.0._srcField"},
+		{"unknown cast", entities.MapRule{Action: "cast/money", SourceField: "/a"}, "_mappings.0._action"},
+		{"unknown action", entities.MapRule{Action: "rename", SourceField: "/a"}, "_mappings.0._action"},
+		{"hash", entities.MapRule{Action: "hash", SourceField: "/email"}, "_mappings.0._action"},
+		{"lower", entities.MapRule{Action: "lower", SourceField: "/email"}, "_mappings.0._action"},
+		{"upper", entities.MapRule{Action: "upper", SourceField: "/email"}, "_mappings.0._action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs ValidationErrors
+			validateMappings(entities.Mappings{Rules: []entities.MapRule{tt.rule}}, &errs)
+			if tt.expectedField == "" {
+				if len(errs) > 0 {
+					t.Errorf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if !hasFieldError(errs, tt.expectedField) {
+				t.Errorf("expected %s error, got %v", tt.expectedField, errs)
+			}
+		})
+	}
+}
+
+func TestEnrichMappingRulesOldStyle(t *testing.T) {
+	destination := &entities.Destination{Mappings: entities.Mappings{Rules: []entities.MapRule{
+		{Action: MoveAction, SourceField: "/a", DestinationField: "/b"},
+		{Action: EraseAction, SourceField: "/c"},
+		{Action: "cast/int", SourceField: "/d", DestinationField: "/e"},
+	}}}
+	config := &enstorages.DestinationConfig{}
+	enrichMappingRules(destination, config)
+
+	expected := []string{"/a -> /b", "/c -> ", "/d -> (integer) /e"}
+	if !reflect.DeepEqual(config.DataLayout.Mapping, expected) {
+		t.Errorf("expected %v, got %v", expected, config.DataLayout.Mapping)
+	}
+	if config.DataLayout.MappingType != schema.Strict || config.DataLayout.Mappings != nil {
+		t.Errorf("expected strict old style mapping, got %+v", config.DataLayout)
+	}
+
+	unmapped, err := unmapMappings(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unmapped, destination.Mappings) {
+		t.Errorf("round trip mismatch: %+v", unmapped)
+	}
+}
+
+func TestEnrichMappingRulesNewStyle(t *testing.T) {
+	destination := &entities.Destination{Type: enstorages.PostgresType, Mappings: entities.Mappings{KeepFields: true, Rules: []entities.MapRule{
+		{Action: MoveAction, SourceField: "/a", DestinationField: "/b"},
+		{Action: ConstantAction, DestinationField: "/source", Value: "web"},
+		{Action: "cast/bool", SourceField: "/flag"},
+	}}}
+	config := &enstorages.DestinationConfig{DataLayout: &enstorages.DataLayout{TableNameTemplate: "events"}}
+	enrichMappingRules(destination, config)
+
+	if len(config.DataLayout.Mapping) > 0 || config.DataLayout.Mappings == nil {
+		t.Fatalf("expected new style mapping, got %+v", config.DataLayout)
+	}
+	expected := []schema.MappingField{
+		{Src: "/a", Dst: "/b", Action: schema.MOVE},
+		{Dst: "/source", Action: schema.CONSTANT, Value: "web"},
+		{Src: "/flag", Dst: "/flag", Action: schema.MOVE, Type: "boolean"},
+	}
+	if !reflect.DeepEqual(config.DataLayout.Mappings.Fields, expected) {
+		t.Errorf("expected %+v, got %+v", expected, config.DataLayout.Mappings.Fields)
+	}
+	if config.DataLayout.TableNameTemplate != "events" {
+		t.Errorf("table name template is lost")
+	}
+}
+
+func TestEnrichMappingRulesStoredRules(t *testing.T) {
+	destination := &entities.Destination{Type: enstorages.PostgresType, Mappings: entities.Mappings{Rules: []entities.MapRule{
+		{Action: MoveAction, SourceField: "/a b", DestinationField: "/c"},
+		{Action: MoveAction, SourceField: "/d"},
+		{Action: "hash", SourceField: "/email"},
+		{Action: "rename"},
+	}}}
+	config := &enstorages.DestinationConfig{}
+	enrichMappingRules(destination, config)
+
+	//invalid paths are kept, rules without required fields are skipped and unknown actions erase the source field
+	expected := []string{"/a b -> /c", "/email -> "}
+	if !reflect.DeepEqual(config.DataLayout.Mapping, expected) {
+		t.Errorf("expected %v, got %v", expected, config.DataLayout.Mapping)
+	}
+}
+
+func TestEnrichMappingRulesJSONCast(t *testing.T) {
+	tests := []struct {
+		destinationType string
+		expectedType    string
+	}{
+		{enstorages.PostgresType, "json"},
+		{enstorages.RedshiftType, "string"},
+		{enstorages.ClickHouseType, "string"},
+		{enstorages.SnowflakeType, "string"},
+		{enstorages.BigQueryType, "string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.destinationType, func(t *testing.T) {
+			destination := &entities.Destination{Type: tt.destinationType, Mappings: entities.Mappings{Rules: []entities.MapRule{
+				{Action: "cast/json", SourceField: "/items"},
+			}}}
+			config := &enstorages.DestinationConfig{}
+			enrichMappingRules(destination, config)
+
+			if fields := config.DataLayout.Mappings.Fields; len(fields) != 1 || fields[0].Type != tt.expectedType {
+				t.Errorf("expected %s cast, got %+v", tt.expectedType, fields)
+			}
+		})
+	}
+}
@@ -85,7 +85,6 @@ func (p *Postgres) CreateDatabase(projectId string) (*entities.Database, error)
 	username := "u_" + strings.ToLower(projectId)
 	logging.Infof("Generated username: " + username)
 	password := random.String(16)
-	logging.Info("Generated password: " + password)
 
 	var queries []string
 	queries = append(queries, fmt.Sprintf("CREATE USER %s WITH PASSWORD '%s';", username, password))
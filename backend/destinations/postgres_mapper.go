@@ -0,0 +1,79 @@
+package destinations
+
+import (
+	"errors"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+func init() {
+	RegisterMapper(&postgresMapper{})
+}
+
+type postgresMapper struct{}
+
+func (pm *postgresMapper) Type() string {
+	return enstorages.PostgresType
+}
+
+func (pm *postgresMapper) FormData() interface{} {
+	return &entities.PostgresFormData{}
+}
+
+func (pm *postgresMapper) SecretFields() []string {
+	return []string{"pgpassword"}
+}
+
+func (pm *postgresMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	pgFormData := formData.(*entities.PostgresFormData)
+	validateMode(pgFormData.Mode, errs)
+	errs.required("pghost", pgFormData.Host)
+	errs.required("pgdatabase", pgFormData.Db)
+	errs.required("pguser", pgFormData.Username)
+	validatePort("pgport", pgFormData.Port, errs)
+	validateConnectionParameters("pgsslmode", pgFormData.SSLMode, "pgconnecttimeout", pgFormData.ConnectTimeout, "pgparameters", pgFormData.Parameters, errs)
+}
+
+func (pm *postgresMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	pgFormData := formData.(*entities.PostgresFormData)
+	return &enstorages.DestinationConfig{
+		Type: enstorages.PostgresType,
+		Mode: pgFormData.Mode,
+		DataLayout: &enstorages.DataLayout{
+			TableNameTemplate: pgFormData.TableName,
+			PrimaryKeyFields:  pgFormData.PKFields,
+		},
+		DataSource: &enadapters.DataSourceConfig{
+			Host:       pgFormData.Host,
+			Port:       pgFormData.Port,
+			Db:         pgFormData.Db,
+			Schema:     pgFormData.Schema,
+			Username:   pgFormData.Username,
+			Password:   pgFormData.Password,
+			Parameters: connectionParameters(pgFormData.SSLMode, pgFormData.ConnectTimeout, pgFormData.Parameters),
+		},
+	}, nil
+}
+
+func (pm *postgresMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.DataSource == nil {
+		return nil, errors.New("datasource is required")
+	}
+	layout := dataLayout(config)
+	sslMode, connectTimeout, parameters := splitConnectionParameters(config.DataSource.Parameters)
+	return &entities.PostgresFormData{
+		Mode:           config.Mode,
+		TableName:      layout.TableNameTemplate,
+		PKFields:       layout.PrimaryKeyFields,
+		Db:             config.DataSource.Db,
+		Host:           config.DataSource.Host,
+		Password:       config.DataSource.Password,
+		Port:           config.DataSource.Port,
+		Schema:         config.DataSource.Schema,
+		Username:       config.DataSource.Username,
+		SSLMode:        sslMode,
+		ConnectTimeout: connectTimeout,
+		Parameters:     parameters,
+	}, nil
+}
@@ -0,0 +1,121 @@
+package destinations
+
+import (
+	"errors"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+const defaultRedshiftPort = 5439
+
+func init() {
+	RegisterMapper(&redshiftMapper{})
+}
+
+type redshiftMapper struct{}
+
+func (rm *redshiftMapper) Type() string {
+	return enstorages.RedshiftType
+}
+
+func (rm *redshiftMapper) FormData() interface{} {
+	return &entities.RedshiftFormData{}
+}
+
+func (rm *redshiftMapper) SecretFields() []string {
+	return []string{"redshiftPassword", "redshiftS3SecretKey"}
+}
+
+func (rm *redshiftMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	rsFormData := formData.(*entities.RedshiftFormData)
+	validateMode(rsFormData.Mode, errs)
+	errs.required("redshiftHost", rsFormData.Host)
+	errs.required("redshiftDB", rsFormData.Db)
+	errs.required("redshiftUser", rsFormData.Username)
+	errs.required("redshiftPassword", rsFormData.Password)
+	validatePort("redshiftPort", rsFormData.Port, errs)
+	validateConnectionParameters("redshiftSSLMode", rsFormData.SSLMode, "redshiftConnectTimeout", rsFormData.ConnectTimeout, "redshiftParameters", rsFormData.Parameters, errs)
+
+	//batch mode works via S3: hosted or configured in the form
+	if rsFormData.Mode != enstorages.StreamMode && !rsFormData.UseHostedS3 {
+		errs.required("redshiftS3AccessKey", rsFormData.S3AccessKey)
+		errs.required("redshiftS3SecretKey", rsFormData.S3SecretKey)
+		errs.required("redshiftS3Bucket", rsFormData.S3Bucket)
+		errs.required("redshiftS3Region", rsFormData.S3Region)
+	}
+}
+
+func (rm *redshiftMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	rsFormData := formData.(*entities.RedshiftFormData)
+	var s3 *enadapters.S3Config
+	if rsFormData.UseHostedS3 {
+		if defaultS3 == nil {
+			return nil, errors.New("hosted S3 isn't configured")
+		}
+		s3 = hostedS3Staging(destinationId, defaultS3)
+	} else if rsFormData.Mode == enstorages.BatchMode {
+		s3 = &enadapters.S3Config{
+			AccessKeyID: rsFormData.S3AccessKey,
+			SecretKey:   rsFormData.S3SecretKey,
+			Bucket:      rsFormData.S3Bucket,
+			Region:      rsFormData.S3Region,
+			Folder:      destinationId,
+		}
+	}
+
+	port := rsFormData.Port
+	if port == 0 {
+		port = defaultRedshiftPort
+	}
+
+	config := enstorages.DestinationConfig{
+		Type: enstorages.RedshiftType,
+		Mode: rsFormData.Mode,
+		DataLayout: &enstorages.DataLayout{
+			TableNameTemplate: rsFormData.TableName,
+		},
+		DataSource: &enadapters.DataSourceConfig{
+			Host:       rsFormData.Host,
+			Port:       port,
+			Db:         rsFormData.Db,
+			Schema:     rsFormData.Schema,
+			Username:   rsFormData.Username,
+			Password:   rsFormData.Password,
+			Parameters: connectionParameters(rsFormData.SSLMode, rsFormData.ConnectTimeout, rsFormData.Parameters),
+		},
+		S3: s3,
+	}
+	return &config, nil
+}
+
+func (rm *redshiftMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.DataSource == nil {
+		return nil, errors.New("datasource is required")
+	}
+	sslMode, connectTimeout, parameters := splitConnectionParameters(config.DataSource.Parameters)
+	rsFormData := &entities.RedshiftFormData{
+		Mode:           config.Mode,
+		TableName:      dataLayout(config).TableNameTemplate,
+		Host:           config.DataSource.Host,
+		Db:             config.DataSource.Db,
+		Schema:         config.DataSource.Schema,
+		Username:       config.DataSource.Username,
+		Password:       config.DataSource.Password,
+		SSLMode:        sslMode,
+		ConnectTimeout: connectTimeout,
+		Parameters:     parameters,
+	}
+	if config.DataSource.Port != defaultRedshiftPort {
+		rsFormData.Port = config.DataSource.Port
+	}
+	if isHostedS3(config.S3, defaultS3) {
+		rsFormData.UseHostedS3 = true
+	} else if config.S3 != nil {
+		rsFormData.S3AccessKey = config.S3.AccessKeyID
+		rsFormData.S3SecretKey = config.S3.SecretKey
+		rsFormData.S3Bucket = config.S3.Bucket
+		rsFormData.S3Region = config.S3.Region
+	}
+	return rsFormData, nil
+}
@@ -0,0 +1,432 @@
+package destinations
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+const (
+	encryptedPrefix = "enc:v1:"
+	masterKeyLength = 32
+	dataKeyLength   = 32
+
+	//SecretMask replaces secrets in configs which are shown to users
+	SecretMask = "********"
+)
+
+//keyRing is configured with InitSecrets. If it is nil secrets are stored as is
+var keyRing *KeyRing
+
+//KeyRing keeps master keys. Every secret value is encrypted with its own random data key which is encrypted (wrapped) with the
+//current master key: enc:v1:<master key id>:<wrapped data key>:<encrypted value>. Nonces are random so the same value is encrypted
+//into different strings. Other master keys are used only for decryption and rewrapping data keys after rotation
+type KeyRing struct {
+	currentId string
+	keys      map[string][]byte
+}
+
+//InitSecrets configure master keys from 'secrets' config section. Secrets are encrypted when destinations are written with the
+//storage. Plaintext secrets written into the storage directly (e.g. by UI) stay plaintext until encrypt-secrets command is run:
+//secrets:
+//  current_key: key2
+//  keys:
+//    key1: base64 encoded 32 bytes
+//    key2: base64 encoded 32 bytes
+func InitSecrets(secretsViper *viper.Viper) error {
+	if secretsViper == nil {
+		logging.Warn("secrets master keys aren't configured. Destinations secrets will be stored as plaintext")
+		return nil
+	}
+
+	kr, err := NewKeyRing(secretsViper.GetString("current_key"), secretsViper.GetStringMapString("keys"))
+	if err != nil {
+		return err
+	}
+
+	keyRing = kr
+	return nil
+}
+
+func NewKeyRing(currentId string, base64Keys map[string]string) (*KeyRing, error) {
+	if len(base64Keys) == 0 {
+		return nil, errors.New("secrets.keys is required config parameter")
+	}
+	if currentId == "" {
+		if len(base64Keys) > 1 {
+			return nil, errors.New("secrets.current_key is required if there are several master keys")
+		}
+		for id := range base64Keys {
+			currentId = id
+		}
+	}
+
+	kr := &KeyRing{currentId: currentId, keys: map[string][]byte{}}
+	for id, base64Key := range base64Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("Master key id [%s] must be non empty and mustn't contain ':'", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(base64Key)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding [%s] master key from base64: %v", id, err)
+		}
+		if len(key) != masterKeyLength {
+			return nil, fmt.Errorf("Master key [%s] must be %d bytes length", id, masterKeyLength)
+		}
+		kr.keys[id] = key
+	}
+
+	if _, ok := kr.keys[currentId]; !ok {
+		return nil, fmt.Errorf("Current master key [%s] isn't in secrets.keys", currentId)
+	}
+	return kr, nil
+}
+
+//EncryptSecrets return destinations copies with sensitive form data fields encrypted with the current master key.
+//Already encrypted values are kept as is or rewrapped if they were encrypted with another master key.
+//Encrypted destinations can't be compared as is: use EqualDestinations
+func EncryptSecrets(destinations []*entities.Destination) ([]*entities.Destination, error) {
+	if keyRing == nil || destinations == nil {
+		return destinations, nil
+	}
+
+	result := make([]*entities.Destination, 0, len(destinations))
+	for _, destination := range destinations {
+		encrypted, err := transformSecrets(destination, keyRing.encrypt)
+		if err != nil {
+			return nil, fmt.Errorf("Error encrypting secrets of destination [%s]: %v", destination.Uid, err)
+		}
+		result = append(result, encrypted)
+	}
+	return result, nil
+}
+
+//EqualDestinations return true if destinations are the same with decrypted secrets. Plaintext and encrypted values are equal
+//if the encrypted value is the plaintext one
+func EqualDestinations(first, second []*entities.Destination) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i := range first {
+		if !equalDecrypted(first[i], second[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalDecrypted(first, second *entities.Destination) bool {
+	var decrypted [][]byte
+	for _, destination := range []*entities.Destination{first, second} {
+		destination, err := decryptSecrets(destination)
+		if err != nil {
+			return false
+		}
+		b, err := json.Marshal(destination)
+		if err != nil {
+			return false
+		}
+		decrypted = append(decrypted, b)
+	}
+	return bytes.Equal(decrypted[0], decrypted[1])
+}
+
+//decryptSecrets return destination copy with decrypted sensitive form data fields. Decrypted destinations are used only for
+//mapping (MapConfig) and comparison and are never written or returned
+func decryptSecrets(destination *entities.Destination) (*entities.Destination, error) {
+	return transformSecrets(destination, func(value interface{}) (interface{}, error) {
+		encrypted, ok := value.(string)
+		if !ok || !isEncrypted(encrypted) {
+			return value, nil
+		}
+		if keyRing == nil {
+			return nil, errors.New("value is encrypted but secrets master keys aren't configured")
+		}
+		return keyRing.decrypt(encrypted)
+	})
+}
+
+//MaskSecrets return destination copy where non empty sensitive form data fields (both plain and encrypted) are replaced with SecretMask
+func MaskSecrets(destination *entities.Destination) (*entities.Destination, error) {
+	return transformSecrets(destination, func(value interface{}) (interface{}, error) {
+		return SecretMask, nil
+	})
+}
+
+//MergeSecrets return updated destination copy where masked (SecretMask) and omitted sensitive form data fields are taken from
+//the existing destination: users get destinations with masked secrets and send them back on update
+func MergeSecrets(updated, existing *entities.Destination) (*entities.Destination, error) {
+	fields := secretFields(updated.Type)
+	if len(fields) == 0 || updated.Type != existing.Type || updated.Data == nil || existing.Data == nil {
+		return updated, nil
+	}
+
+	data, err := formDataMap(updated)
+	if err != nil {
+		return nil, err
+	}
+	existingData, err := formDataMap(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		existingValue, ok := existingData[field]
+		if !ok {
+			continue
+		}
+		value, ok := data[field]
+		if !ok || value == SecretMask {
+			data[field] = existingValue
+			continue
+		}
+
+		//masked list items are taken from the same positions
+		items, ok := value.([]interface{})
+		existingItems, existingOk := existingValue.([]interface{})
+		if !ok || !existingOk {
+			continue
+		}
+		for i, item := range items {
+			if item == SecretMask && i < len(existingItems) {
+				items[i] = existingItems[i]
+			}
+		}
+	}
+
+	result := *updated
+	result.Data = data
+	return &result, nil
+}
+
+//formDataMap return copy of the destination form data as a map
+func formDataMap(destination *entities.Destination) (map[string]interface{}, error) {
+	b, err := json.Marshal(destination.Data)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshaling form data: %v", err)
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling form data: %v", err)
+	}
+	return data, nil
+}
+
+//transformSecrets return destination copy where non empty sensitive fields are replaced with transform results
+func transformSecrets(destination *entities.Destination, transform func(value interface{}) (interface{}, error)) (*entities.Destination, error) {
+	fields := secretFields(destination.Type)
+	if len(fields) == 0 || destination.Data == nil {
+		return destination, nil
+	}
+
+	data, err := formDataMap(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		value, ok := data[field]
+		if !ok || isEmptyValue(value) {
+			continue
+		}
+
+		//list items are transformed separately so the field type is kept
+		if items, ok := value.([]interface{}); ok {
+			transformedItems := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				if isEmptyValue(item) {
+					transformedItems = append(transformedItems, item)
+					continue
+				}
+				transformed, err := transform(item)
+				if err != nil {
+					return nil, fmt.Errorf("[%s]: %v", field, err)
+				}
+				transformedItems = append(transformedItems, transformed)
+			}
+			data[field] = transformedItems
+			continue
+		}
+
+		transformed, err := transform(value)
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: %v", field, err)
+		}
+		data[field] = transformed
+	}
+
+	result := *destination
+	result.Data = data
+	return &result, nil
+}
+
+//isEncrypted return true if the value is an encrypted secret
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+func (kr *KeyRing) encrypt(value interface{}) (interface{}, error) {
+	if encrypted, ok := value.(string); ok && isEncrypted(encrypted) {
+		return kr.rewrap(encrypted)
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	//each data key encrypts only one value
+	dataKey, err := randomBytes(dataKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := seal(kr.keys[kr.currentId], dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return format(kr.currentId, wrappedKey, ciphertext), nil
+}
+
+//rewrap encrypt value data key with the current master key. The value ciphertext isn't changed: the data key is random and
+//doesn't depend on the previous master key
+func (kr *KeyRing) rewrap(encrypted string) (string, error) {
+	keyId, wrappedKey, ciphertext, err := parse(encrypted)
+	if err != nil {
+		return "", err
+	}
+	if keyId == kr.currentId {
+		return encrypted, nil
+	}
+
+	dataKey, err := kr.unwrap(keyId, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	newWrappedKey, err := seal(kr.keys[kr.currentId], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return format(kr.currentId, newWrappedKey, ciphertext), nil
+}
+
+func (kr *KeyRing) decrypt(encrypted string) (interface{}, error) {
+	keyId, wrappedKey, ciphertext, err := parse(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := kr.unwrap(keyId, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting value: %v", err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(plaintext, &value); err != nil {
+		return nil, fmt.Errorf("Error unmarshaling decrypted value: %v", err)
+	}
+	return value, nil
+}
+
+func (kr *KeyRing) unwrap(keyId string, wrappedKey []byte) ([]byte, error) {
+	masterKey, ok := kr.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("Unknown master key [%s]", keyId)
+	}
+	dataKey, err := open(masterKey, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting data key with [%s] master key: %v", keyId, err)
+	}
+	return dataKey, nil
+}
+
+//seal encrypt plaintext with AES-256-GCM. Random nonce is put before ciphertext
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(length int) ([]byte, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("Error generating random bytes: %v", err)
+	}
+	return b, nil
+}
+
+func format(keyId string, wrappedKey, ciphertext []byte) string {
+	return encryptedPrefix + keyId + ":" + base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" + base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func parse(encrypted string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(encrypted, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted data key: %v", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %v", err)
+	}
+	return parts[0], wrappedKey, ciphertext, nil
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package destinations
+
+import (
+	"encoding/base64"
+	"github.com/jitsucom/enhosted/entities"
+	"strings"
+	"testing"
+)
+
+func testMasterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), masterKeyLength)))
+}
+
+func withKeyRing(t *testing.T, currentId string, keys map[string]string) {
+	kr, err := NewKeyRing(currentId, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := keyRing
+	keyRing = kr
+	t.Cleanup(func() { keyRing = previous })
+}
+
+func pgDestination(password interface{}) *entities.Destination {
+	return &entities.Destination{Id: "pg", Type: "postgres", Data: map[string]interface{}{"pghost": "host", "pgpassword": password}}
+}
+
+func encryptOne(t *testing.T, destination *entities.Destination) *entities.Destination {
+	encrypted, err := EncryptSecrets([]*entities.Destination{destination})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypted[0]
+}
+
+func TestEncryptSecretsIsRandomized(t *testing.T) {
+	withKeyRing(t, "", map[string]string{"key1": testMasterKey('a')})
+
+	first := encryptOne(t, pgDestination("secret"))
+	second := encryptOne(t, pgDestination("secret"))
+	firstValue := first.Data.(map[string]interface{})["pgpassword"].(string)
+	secondValue := second.Data.(map[string]interface{})["pgpassword"].(string)
+	if !isEncrypted(firstValue) || firstValue == secondValue {
+		t.Fatalf("expected different encrypted values, got %s and %s", firstValue, secondValue)
+	}
+	if first.Data.(map[string]interface{})["pghost"] != "host" {
+		t.Errorf("not secret field is changed: %v", first.Data)
+	}
+
+	for _, encrypted := range []string{firstValue, secondValue} {
+		decrypted, err := keyRing.decrypt(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != "secret" {
+			t.Errorf("expected secret, got %v", decrypted)
+		}
+	}
+
+	//already encrypted values are kept
+	again := encryptOne(t, first)
+	if again.Data.(map[string]interface{})["pgpassword"] != firstValue {
+		t.Errorf("encrypted value is changed")
+	}
+}
+
+func TestEncryptSecretsRewrap(t *testing.T) {
+	withKeyRing(t, "", map[string]string{"key1": testMasterKey('a')})
+	encrypted := encryptOne(t, pgDestination("secret"))
+
+	withKeyRing(t, "key2", map[string]string{"key1": testMasterKey('a'), "key2": testMasterKey('b')})
+	rewrapped := encryptOne(t, encrypted)
+	value := rewrapped.Data.(map[string]interface{})["pgpassword"].(string)
+	if !strings.HasPrefix(value, encryptedPrefix+"key2:") {
+		t.Fatalf("expected value wrapped with key2, got %s", value)
+	}
+
+	//the old master key isn't required after rewrapping
+	withKeyRing(t, "", map[string]string{"key2": testMasterKey('b')})
+	decrypted, err := keyRing.decrypt(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != "secret" {
+		t.Errorf("expected secret, got %v", decrypted)
+	}
+}
+
+func TestEqualDestinations(t *testing.T) {
+	withKeyRing(t, "", map[string]string{"key1": testMasterKey('a')})
+	plain := pgDestination("secret")
+	encrypted := encryptOne(t, plain)
+
+	if !EqualDestinations([]*entities.Destination{plain}, []*entities.Destination{encrypted}) {
+		t.Error("plaintext and encrypted destinations must be equal")
+	}
+	if !EqualDestinations([]*entities.Destination{encrypted}, []*entities.Destination{encryptOne(t, plain)}) {
+		t.Error("destinations encrypted twice must be equal")
+	}
+	if EqualDestinations([]*entities.Destination{encrypted}, []*entities.Destination{pgDestination("other")}) {
+		t.Error("destinations with different secrets must differ")
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	masked, err := MaskSecrets(pgDestination("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := masked.Data.(map[string]interface{})
+	if data["pgpassword"] != SecretMask || data["pghost"] != "host" {
+		t.Errorf("unexpected masked form data: %v", data)
+	}
+
+	masked, err = MaskSecrets(pgDestination(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if masked.Data.(map[string]interface{})["pgpassword"] != "" {
+		t.Errorf("empty secret must stay empty")
+	}
+}
@@ -0,0 +1,115 @@
+package destinations
+
+import (
+	"errors"
+	"github.com/jitsucom/enhosted/entities"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+func init() {
+	RegisterMapper(&snowflakeMapper{})
+}
+
+type snowflakeMapper struct{}
+
+func (sm *snowflakeMapper) Type() string {
+	return enstorages.SnowflakeType
+}
+
+func (sm *snowflakeMapper) FormData() interface{} {
+	return &entities.SnowflakeFormData{}
+}
+
+func (sm *snowflakeMapper) SecretFields() []string {
+	return []string{"snowflakePassword", "snowflakeS3SecretKey", "snowflakeJSONKey"}
+}
+
+func (sm *snowflakeMapper) Validate(formData interface{}, errs *ValidationErrors) {
+	snowflakeFormData := formData.(*entities.SnowflakeFormData)
+	validateMode(snowflakeFormData.Mode, errs)
+	errs.required("snowflakeAccount", snowflakeFormData.Account)
+	errs.required("snowflakeWarehouse", snowflakeFormData.Warehouse)
+	errs.required("snowflakeDB", snowflakeFormData.DB)
+	errs.required("snowflakeUsername", snowflakeFormData.Username)
+
+	if snowflakeFormData.UseHostedS3 {
+		if snowflakeFormData.S3Bucket != "" || snowflakeFormData.GCSBucket != "" {
+			errs.add("snowflakeUseHostedS3", "hosted staging can't be used with S3 or Google Cloud Storage from the form")
+		}
+		return
+	}
+
+	if snowflakeFormData.S3Bucket != "" && snowflakeFormData.GCSBucket != "" {
+		errs.add("snowflakeGcsBucket", "S3 and Google Cloud Storage staging can't be configured simultaneously")
+		return
+	}
+
+	if snowflakeFormData.S3Bucket != "" {
+		errs.required("snowflakeS3Region", snowflakeFormData.S3Region)
+		errs.required("snowflakeS3AccessKey", snowflakeFormData.S3AccessKey)
+		errs.required("snowflakeS3SecretKey", snowflakeFormData.S3SecretKey)
+	} else if snowflakeFormData.GCSBucket != "" {
+		//google cloud storage is accessed through snowflake stage (storage integration)
+		validateGoogleKey("snowflakeJSONKey", snowflakeFormData.GCSKey, errs)
+		errs.required("snowflakeStageName", snowflakeFormData.StageName)
+	} else if snowflakeFormData.Mode != enstorages.StreamMode {
+		errs.add("snowflakeS3Bucket", "S3 or Google Cloud Storage staging is required in batch mode")
+	}
+}
+
+func (sm *snowflakeMapper) Map(destinationId string, formData interface{}, defaultS3 *enadapters.S3Config) (*enstorages.DestinationConfig, error) {
+	snowflakeFormData := formData.(*entities.SnowflakeFormData)
+	var s3 *enadapters.S3Config
+	var gcs *enadapters.GoogleConfig
+	if snowflakeFormData.UseHostedS3 {
+		if defaultS3 == nil {
+			return nil, errors.New("hosted S3 isn't configured")
+		}
+		s3 = hostedS3Staging(destinationId, defaultS3)
+	} else if snowflakeFormData.S3Bucket != "" {
+		s3 = &enadapters.S3Config{Region: snowflakeFormData.S3Region, Bucket: snowflakeFormData.S3Bucket, AccessKeyID: snowflakeFormData.S3AccessKey, SecretKey: snowflakeFormData.S3SecretKey}
+	} else if snowflakeFormData.GCSBucket != "" {
+		gcs = &enadapters.GoogleConfig{Bucket: snowflakeFormData.GCSBucket, KeyFile: snowflakeFormData.GCSKey}
+	}
+	return &enstorages.DestinationConfig{
+		Type: enstorages.SnowflakeType,
+		Mode: snowflakeFormData.Mode,
+		DataLayout: &enstorages.DataLayout{
+			TableNameTemplate: snowflakeFormData.TableName,
+		},
+		Snowflake: &enadapters.SnowflakeConfig{Account: snowflakeFormData.Account, Warehouse: snowflakeFormData.Warehouse, Db: snowflakeFormData.DB, Schema: snowflakeFormData.Schema, Username: snowflakeFormData.Username, Password: snowflakeFormData.Password, Stage: snowflakeFormData.StageName},
+		S3:        s3,
+		Google:    gcs,
+	}, nil
+}
+
+func (sm *snowflakeMapper) Unmap(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) (interface{}, error) {
+	if config.Snowflake == nil {
+		return nil, errors.New("snowflake is required")
+	}
+	snowflakeFormData := &entities.SnowflakeFormData{
+		Mode:      config.Mode,
+		TableName: dataLayout(config).TableNameTemplate,
+		Account:   config.Snowflake.Account,
+		Warehouse: config.Snowflake.Warehouse,
+		DB:        config.Snowflake.Db,
+		Schema:    config.Snowflake.Schema,
+		Username:  config.Snowflake.Username,
+		Password:  config.Snowflake.Password,
+		StageName: config.Snowflake.Stage,
+	}
+	if isHostedS3(config.S3, defaultS3) {
+		snowflakeFormData.UseHostedS3 = true
+	} else if config.S3 != nil {
+		snowflakeFormData.S3Region = config.S3.Region
+		snowflakeFormData.S3Bucket = config.S3.Bucket
+		snowflakeFormData.S3AccessKey = config.S3.AccessKeyID
+		snowflakeFormData.S3SecretKey = config.S3.SecretKey
+	}
+	if config.Google != nil {
+		snowflakeFormData.GCSBucket = config.Google.Bucket
+		snowflakeFormData.GCSKey = config.Google.KeyFile
+	}
+	return snowflakeFormData, nil
+}
@@ -0,0 +1,30 @@
+package destinations
+
+import (
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	enstorages "github.com/jitsucom/eventnative/storages"
+)
+
+//HostedStaging return hosted S3 folder where the destination stages batch files. Empty folder means the destination
+//doesn't use the hosted bucket. Only staging destinations are considered: hosted file dumps aren't staging
+func HostedStaging(config *enstorages.DestinationConfig, defaultS3 *enadapters.S3Config) string {
+	switch config.Type {
+	case enstorages.RedshiftType, enstorages.SnowflakeType:
+		if isHostedS3(config.S3, defaultS3) {
+			return config.S3.Folder
+		}
+	}
+	return ""
+}
+
+//hostedS3Staging return the hosted S3 config with the destination folder
+func hostedS3Staging(destinationId string, defaultS3 *enadapters.S3Config) *enadapters.S3Config {
+	return &enadapters.S3Config{
+		AccessKeyID: defaultS3.AccessKeyID,
+		SecretKey:   defaultS3.SecretKey,
+		Bucket:      defaultS3.Bucket,
+		Region:      defaultS3.Region,
+		Endpoint:    defaultS3.Endpoint,
+		Folder:      destinationId,
+	}
+}
@@ -0,0 +1,123 @@
+package destinations
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"strings"
+)
+
+const formDataField = "_formData"
+
+//FieldError is a validation error of one destination form data field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+//ValidationErrors is returned from Validate when destination form data has invalid fields
+type ValidationErrors []*FieldError
+
+func (ve ValidationErrors) Error() string {
+	var messages []string
+	for _, fieldError := range ve {
+		messages = append(messages, fieldError.Field+": "+fieldError.Message)
+	}
+	return "Invalid destination form data: " + strings.Join(messages, "; ")
+}
+
+//add append field error
+func (ve *ValidationErrors) add(field, message string) {
+	*ve = append(*ve, &FieldError{Field: field, Message: message})
+}
+
+//required append field error if the value is empty
+func (ve *ValidationErrors) required(field, value string) {
+	if value == "" {
+		ve.add(field, "is required")
+	}
+}
+
+//Validate check destination form data with the destination type mapper. Return ValidationErrors if there are invalid fields.
+//Secrets aren't decrypted: encrypted values are considered as non empty and their format isn't checked
+func Validate(destination *entities.Destination) error {
+	var errs ValidationErrors
+	mapper, ok := mappers[destination.Type]
+	if !ok {
+		errs.add("_type", fmt.Sprintf("Unknown destination type: %s", destination.Type))
+		return errs
+	}
+
+	formData := mapper.FormData()
+	if parseFormData(destination, formData, &errs) {
+		mapper.Validate(formData, &errs)
+	}
+	validateMappings(destination.Mappings, &errs)
+	if err := destination.Schedule.Validate(); err != nil {
+		errs.add("_schedule", err.Error())
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//parseFormData unmarshal destination form data into the type form data struct. Return false if form data is malformed
+func parseFormData(destination *entities.Destination, formData interface{}, errs *ValidationErrors) bool {
+	if destination.Data == nil {
+		errs.add(formDataField, "is required")
+		return false
+	}
+
+	b, err := json.Marshal(destination.Data)
+	if err != nil {
+		errs.add(formDataField, fmt.Sprintf("malformed form data: %v", err))
+		return false
+	}
+
+	if err := json.Unmarshal(b, formData); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+			errs.add(typeErr.Field, fmt.Sprintf("must be %s", typeErr.Type.String()))
+		} else {
+			errs.add(formDataField, fmt.Sprintf("malformed form data: %v", err))
+		}
+		return false
+	}
+	return true
+}
+
+//validateMode check destination mode. Empty mode is batch by default
+func validateMode(mode string, errs *ValidationErrors) {
+	if mode != "" && mode != enstorages.BatchMode && mode != enstorages.StreamMode {
+		errs.add("mode", fmt.Sprintf("must be %s or %s", enstorages.BatchMode, enstorages.StreamMode))
+	}
+}
+
+func validatePort(field string, port int, errs *ValidationErrors) {
+	if port < 0 || port > 65535 {
+		errs.add(field, "must be in range 0-65535")
+	}
+}
+
+//validateGoogleKey check that google key file is a non empty JSON object, JSON string or a file path
+func validateGoogleKey(field string, keyFile interface{}, errs *ValidationErrors) {
+	switch key := keyFile.(type) {
+	case map[string]interface{}:
+		if len(key) == 0 {
+			errs.add(field, "is required")
+		}
+	case string:
+		key = strings.TrimSpace(key)
+		if key == "" {
+			errs.add(field, "is required")
+		} else if strings.HasPrefix(key, "{") && !json.Valid([]byte(key)) {
+			errs.add(field, "must be a valid JSON")
+		}
+	case nil:
+		errs.add(field, "is required")
+	default:
+		errs.add(field, "must be a JSON object or a string")
+	}
+}
@@ -0,0 +1,66 @@
+package destinations
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name           string
+		destination    *entities.Destination
+		expectedFields []string
+	}{
+		{"valid",
+			&entities.Destination{Type: "postgres", Data: map[string]interface{}{"pghost": "pg.example.com", "pgdatabase": "db", "pguser": "user"}},
+			nil},
+		{"unknown type",
+			&entities.Destination{Type: "mysql", Data: map[string]interface{}{}},
+			[]string{"_type"}},
+		{"no form data",
+			&entities.Destination{Type: "postgres"},
+			[]string{"_formData"}},
+		{"wrong field type",
+			&entities.Destination{Type: "postgres", Data: map[string]interface{}{"pghost": "pg.example.com", "pgdatabase": "db", "pguser": "user", "pgport": "5432"}},
+			[]string{"pgport"}},
+		{"required fields",
+			&entities.Destination{Type: "postgres", Data: map[string]interface{}{"pgpassword": "secret"}},
+			[]string{"pghost", "pgdatabase", "pguser"}},
+		{"invalid mode and port",
+			&entities.Destination{Type: "postgres", Data: map[string]interface{}{"mode": "sync", "pghost": "pg.example.com", "pgdatabase": "db", "pguser": "user", "pgport": 70000}},
+			[]string{"mode", "pgport"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.destination)
+			if len(tt.expectedFields) == 0 {
+				if err != nil {
+					t.Fatalf("expected valid destination, got %v", err)
+				}
+				return
+			}
+
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("expected validation errors, got %v", err)
+			}
+			if len(errs) != len(tt.expectedFields) {
+				t.Errorf("expected errors of %v fields, got %v", tt.expectedFields, errs)
+			}
+			for _, field := range tt.expectedFields {
+				if !hasFieldError(errs, field) {
+					t.Errorf("expected [%s] field error, got %v", field, errs)
+				}
+			}
+		})
+	}
+}
+
+func hasFieldError(errs ValidationErrors, field string) bool {
+	for _, fieldError := range errs {
+		if fieldError.Field == field {
+			return true
+		}
+	}
+	return false
+}
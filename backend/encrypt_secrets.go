@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/jitsucom/enhosted/storages"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+const encryptSecretsCommand = "encrypt-secrets"
+
+//runSecretsEncryption encrypt plaintext destinations secrets in the storage and rewrap secrets after master key rotation
+//usage: enhosted -cfg=config.yaml encrypt-secrets [-storage=storage] [-dry-run]
+//Master key rotation: add a new key into secrets.keys, set it as secrets.current_key and run the command.
+//Previous keys should be kept in secrets.keys while destinations revisions encrypted with them might be rolled back
+func runSecretsEncryption(args []string) {
+	command := flag.NewFlagSet(encryptSecretsCommand, flag.ExitOnError)
+	storageKey := command.String("storage", "storage", "config key of the storage")
+	dryRun := command.Bool("dry-run", false, "only report which projects destinations would be rewritten")
+	if err := command.Parse(args); err != nil {
+		logging.Fatal(err)
+	}
+	if !viper.IsSet("secrets") {
+		logging.Fatal("secrets master keys must be configured to run " + encryptSecretsCommand)
+	}
+
+	storage, err := storages.NewStorage(context.Background(), viper.Sub(*storageKey), nil)
+	if err != nil {
+		logging.Fatalf("Failed to create storage [%s]: %v", *storageKey, err)
+	}
+	defer storage.Close()
+
+	changed, err := storages.EncryptSecrets(storage, *dryRun)
+	if err != nil {
+		logging.Fatalf("Failed to encrypt destinations secrets in storage [%s]: %v", *storageKey, err)
+	}
+
+	if *dryRun {
+		logging.Infof("Dry run: storage [%s] wasn't modified. Projects destinations to encrypt: %d", *storageKey, len(changed))
+	} else {
+		logging.Infof("Destinations secrets have been encrypted in storage [%s]. Rewritten projects destinations: %d", *storageKey, len(changed))
+	}
+	if len(changed) > 0 {
+		logging.Infof("Projects: %s", strings.Join(changed, ", "))
+	}
+}
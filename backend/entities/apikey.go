@@ -1,15 +1,101 @@
 package entities
 
+import "time"
+
 //ApiKey entity is stored in main storage (Firebase)
 type ApiKey struct {
 	Id           string   `firestore:"uid" json:"uid" yaml:"id,omitempty"`
+	Label        string   `firestore:"label,omitempty" json:"label,omitempty" yaml:"-"`
 	ClientSecret string   `firestore:"jsAuth" json:"jsAuth" yaml:"client_secret,omitempty"`
 	ServerSecret string   `firestore:"serverAuth" json:"serverAuth" yaml:"server_secret,omitempty"`
 	Origins      []string `firestore:"origins" json:"origins" yaml:"origins,omitempty"`
+	//DeletedAt is a soft deletion tombstone. Deleted keys aren't served to EventNative and might be restored
+	DeletedAt string `firestore:"_deletedAt,omitempty" json:"_deletedAt,omitempty" yaml:"-"`
+	//RevokedAt is set when the key is revoked. Revoked keys are deleted and can't be restored
+	RevokedAt string `firestore:"_revokedAt,omitempty" json:"_revokedAt,omitempty" yaml:"-"`
+	//RotatedAt is the last time when the key secrets were regenerated
+	RotatedAt string `firestore:"_rotatedAt,omitempty" json:"_rotatedAt,omitempty" yaml:"-"`
+	//Enabled is false if the key is paused. Nil means enabled
+	Enabled *bool `firestore:"_enabled,omitempty" json:"_enabled,omitempty" yaml:"-"`
+	//Schedule is a period when the key is disabled
+	Schedule *Schedule `firestore:"_schedule,omitempty" json:"_schedule,omitempty" yaml:"-"`
+	//ExpiresAt is RFC3339 time after which the key isn't served to EventNative. Empty means the key doesn't expire
+	ExpiresAt string `firestore:"_expiresAt,omitempty" json:"_expiresAt,omitempty" yaml:"-"`
+	//PreviousSecrets are secrets replaced by rotation. They are served to EventNative until their grace period ends
+	PreviousSecrets []*PreviousSecrets `firestore:"_previousSecrets,omitempty" json:"_previousSecrets,omitempty" yaml:"-"`
+}
+
+//PreviousSecrets are client and server secrets which are valid until ExpiresAt (RFC3339 time)
+type PreviousSecrets struct {
+	ClientSecret string `firestore:"jsAuth" json:"jsAuth"`
+	ServerSecret string `firestore:"serverAuth" json:"serverAuth"`
+	ExpiresAt    string `firestore:"expiresAt" json:"expiresAt"`
+}
+
+func (ak *ApiKey) IsDeleted() bool {
+	return ak.DeletedAt != ""
+}
+
+func (ak *ApiKey) IsRevoked() bool {
+	return ak.RevokedAt != ""
+}
+
+//IsEnabled return false if the key is disabled with the flag, by the schedule or it is expired. Disabled keys aren't served to EventNative
+func (ak *ApiKey) IsEnabled(now time.Time) bool {
+	return (ak.Enabled == nil || *ak.Enabled) && !ak.Schedule.IsDisabled(now) && !ak.IsExpired(now)
+}
+
+//IsExpired return true if the key expiration time has come. Malformed expiration time doesn't expire the key
+func (ak *ApiKey) IsExpired(now time.Time) bool {
+	expiresAt, err := parseScheduleTime(ak.ExpiresAt)
+	return err == nil && !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+//ValidPreviousSecrets return previous secrets which grace period hasn't ended yet. Secrets with malformed expiration time aren't valid
+func (ak *ApiKey) ValidPreviousSecrets(now time.Time) []*PreviousSecrets {
+	var valid []*PreviousSecrets
+	for _, secrets := range ak.PreviousSecrets {
+		expiresAt, err := parseScheduleTime(secrets.ExpiresAt)
+		if err == nil && now.Before(expiresAt) {
+			valid = append(valid, secrets)
+		}
+	}
+	return valid
+}
+
+//LastChange return the last time which isn't after now when the key was enabled or disabled by the schedule, expired
+//or one of its previous secrets expired. Return zero time if there isn't one.
+//Expirations are taken into account before the pruning job saves the keys
+func (ak *ApiKey) LastChange(now time.Time) time.Time {
+	last := ak.Schedule.LastChange(now)
+	if ak.IsExpired(now) {
+		expiresAt, _ := parseScheduleTime(ak.ExpiresAt)
+		last = LatestChange(last, expiresAt)
+	}
+	for _, secrets := range ak.PreviousSecrets {
+		if expiresAt, err := parseScheduleTime(secrets.ExpiresAt); err == nil && !expiresAt.After(now) {
+			last = LatestChange(last, expiresAt)
+		}
+	}
+	return last
+}
+
+//NextChange return the first time after now when the key is enabled or disabled by the schedule, expires
+//or one of its previous secrets expires. Return zero time if there isn't one
+func (ak *ApiKey) NextChange(now time.Time) time.Time {
+	next := ak.Schedule.NextChange(now)
+	if expiresAt, err := parseScheduleTime(ak.ExpiresAt); err == nil && expiresAt.After(now) {
+		next = EarliestChange(next, expiresAt)
+	}
+	for _, secrets := range ak.ValidPreviousSecrets(now) {
+		expiresAt, _ := parseScheduleTime(secrets.ExpiresAt)
+		next = EarliestChange(next, expiresAt)
+	}
+	return next
 }
 
 //ApiKeys entity is stored in main storage (Firebase)
 type ApiKeys struct {
-	LastUpdated string    `firestore:"_lastUpdated" yaml:"_lastUpdated,omitempty"`
+	LastUpdated string    `firestore:"_lastUpdated" json:"_lastUpdated" yaml:"_lastUpdated,omitempty"`
 	Keys        []*ApiKey `firestore:"keys" json:"keys" yaml:"keys,omitempty"`
 }
@@ -0,0 +1,57 @@
+package entities
+
+import (
+	"testing"
+)
+
+func TestApiKeyExpiration(t *testing.T) {
+	apiKey := &ApiKey{ExpiresAt: "2021-01-01T12:00:00Z", PreviousSecrets: []*PreviousSecrets{
+		{ClientSecret: "js.first", ExpiresAt: "2021-01-01T10:00:00Z"},
+		{ClientSecret: "js.second", ExpiresAt: "2021-01-01T11:00:00Z"},
+		{ClientSecret: "js.malformed", ExpiresAt: "soon"},
+	}}
+
+	tests := []struct {
+		now     string
+		expired bool
+		valid   int
+		next    string
+		last    string
+	}{
+		{"2021-01-01T09:00:00Z", false, 2, "2021-01-01T10:00:00Z", ""},
+		{"2021-01-01T10:00:00Z", false, 1, "2021-01-01T11:00:00Z", "2021-01-01T10:00:00Z"},
+		{"2021-01-01T11:30:00Z", false, 0, "2021-01-01T12:00:00Z", "2021-01-01T11:00:00Z"},
+		{"2021-01-01T12:00:00Z", true, 0, "", "2021-01-01T12:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.now, func(t *testing.T) {
+			now := scheduleTime(tt.now)
+			if actual := apiKey.IsExpired(now); actual != tt.expired {
+				t.Errorf("IsExpired() = %v, expected %v", actual, tt.expired)
+			}
+			if actual := apiKey.IsEnabled(now); actual == tt.expired {
+				t.Errorf("IsEnabled() = %v, expected %v", actual, !tt.expired)
+			}
+			if actual := len(apiKey.ValidPreviousSecrets(now)); actual != tt.valid {
+				t.Errorf("ValidPreviousSecrets() returned %d secrets, expected %d", actual, tt.valid)
+			}
+			checkChange(t, "NextChange", apiKey.NextChange(now), tt.next)
+			checkChange(t, "LastChange", apiKey.LastChange(now), tt.last)
+		})
+	}
+}
+
+func TestApiKeyChangesWithSchedule(t *testing.T) {
+	apiKey := &ApiKey{ExpiresAt: "2021-01-01T12:00:00Z", Schedule: &Schedule{DisableFrom: "2021-01-01T10:00:00Z", DisableTo: "2021-01-01T14:00:00Z"}}
+
+	now := scheduleTime("2021-01-01T11:00:00Z")
+	checkChange(t, "NextChange", apiKey.NextChange(now), "2021-01-01T12:00:00Z")
+	checkChange(t, "LastChange", apiKey.LastChange(now), "2021-01-01T10:00:00Z")
+
+	now = scheduleTime("2021-01-01T15:00:00Z")
+	checkChange(t, "NextChange", apiKey.NextChange(now), "")
+	checkChange(t, "LastChange", apiKey.LastChange(now), "2021-01-01T14:00:00Z")
+	if apiKey.IsEnabled(now) {
+		t.Error("expired key must be disabled after the schedule period")
+	}
+}
@@ -0,0 +1,26 @@
+package entities
+
+const (
+	StepOk      = "ok"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+//ConnectionTest is the last deep connection test of a destination. It is stored in main storage per project
+type ConnectionTest struct {
+	DestinationUid string                `firestore:"destinationUid" json:"destinationUid"`
+	Ok             bool                  `firestore:"ok" json:"ok"`
+	TestedAt       string                `firestore:"testedAt" json:"testedAt"`
+	Steps          []*ConnectionTestStep `firestore:"steps" json:"steps"`
+}
+
+//ConnectionTestStep is a result of one connection test step (DNS resolution, TCP connect, auth, etc.)
+type ConnectionTestStep struct {
+	Name   string `firestore:"name" json:"name"`
+	Status string `firestore:"status" json:"status"`
+	//Message is a step result or an error
+	Message string `firestore:"message,omitempty" json:"message,omitempty"`
+	//Hint is an advice how to fix the failed step
+	Hint       string `firestore:"hint,omitempty" json:"hint,omitempty"`
+	DurationMs int64  `firestore:"durationMs" json:"durationMs"`
+}
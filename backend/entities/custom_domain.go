@@ -3,10 +3,16 @@ package entities
 type CustomDomain struct {
 	Name   string `firestore:"name" json:"name"`
 	Status string `firestore:"status" json:"status"`
+	//DeletedAt is a soft deletion tombstone. Certificates aren't issued for deleted domains
+	DeletedAt string `firestore:"_deletedAt,omitempty" json:"_deletedAt,omitempty"`
+}
+
+func (cd *CustomDomain) IsDeleted() bool {
+	return cd.DeletedAt != ""
 }
 
 type CustomDomains struct {
-	LastUpdated               string          `firestore:"_lastUpdated"`
-	CertificateExpirationDate string          `firestore:"_certificateExpiration"`
+	LastUpdated               string          `firestore:"_lastUpdated" json:"_lastUpdated"`
+	CertificateExpirationDate string          `firestore:"_certificateExpiration" json:"_certificateExpiration"`
 	Domains                   []*CustomDomain `firestore:"domains" json:"domains"`
 }
@@ -1,5 +1,7 @@
 package entities
 
+import "time"
+
 //Destination entity is stored in main storage (Firebase)
 type Destination struct {
 	Id       string      `firestore:"_id" json:"_id"`
@@ -8,11 +10,44 @@ type Destination struct {
 	Data     interface{} `firestore:"_formData" json:"_formData"`
 	Mappings Mappings    `firestore:"_mappings" json:"_mappings"`
 	OnlyKeys []string    `firestore:"_onlyKeys" json:"_onlyKeys"`
+	Comment  string      `firestore:"_comment" json:"_comment"`
+
+	ConnectionTestOk       *bool  `firestore:"_connectionTestOk,omitempty" json:"_connectionTestOk,omitempty"`
+	ConnectionErrorMessage string `firestore:"_connectionErrorMessage,omitempty" json:"_connectionErrorMessage,omitempty"`
+	//DeletedAt is a soft deletion tombstone. Deleted destinations aren't served to EventNative and might be restored
+	DeletedAt string `firestore:"_deletedAt,omitempty" json:"_deletedAt,omitempty"`
+	//Enabled is false if the destination is paused (e.g. during warehouse maintenance). Nil means enabled
+	Enabled *bool `firestore:"_enabled,omitempty" json:"_enabled,omitempty"`
+	//Schedule is a period when the destination is disabled
+	Schedule *Schedule `firestore:"_schedule,omitempty" json:"_schedule,omitempty"`
+}
+
+func (d *Destination) IsDeleted() bool {
+	return d.DeletedAt != ""
+}
+
+//IsEnabled return false if the destination is disabled with the flag or by the schedule. Disabled destinations aren't served to EventNative
+func (d *Destination) IsEnabled(now time.Time) bool {
+	return (d.Enabled == nil || *d.Enabled) && !d.Schedule.IsDisabled(now)
+}
+
+//LastChange return the last time which isn't after now when the destination was enabled or disabled by the schedule
+func (d *Destination) LastChange(now time.Time) time.Time {
+	return d.Schedule.LastChange(now)
 }
 
 //Destinations entity is stored in main storage (Firebase)
 type Destinations struct {
-	LastUpdated  string         `firestore:"_lastUpdated"`
+	LastUpdated  string         `firestore:"_lastUpdated" json:"_lastUpdated"`
+	Destinations []*Destination `firestore:"destinations" json:"destinations"`
+}
+
+//DestinationsRevision entity is stored in main storage. It is a snapshot of project destinations
+type DestinationsRevision struct {
+	Id           string         `firestore:"_id" json:"_id"`
+	Author       string         `firestore:"_author" json:"_author"`
+	CreatedAt    string         `firestore:"_createdAt" json:"_createdAt"`
+	Comment      string         `firestore:"_comment" json:"_comment"`
 	Destinations []*Destination `firestore:"destinations" json:"destinations"`
 }
 
@@ -29,4 +64,6 @@ type MapRule struct {
 	Action           string `firestore:"_action" json:"_action"`
 	SourceField      string `firestore:"_srcField" json:"_srcField"`
 	DestinationField string `firestore:"_dstField" json:"_dstField"`
+	//Value is used only in constant rules
+	Value interface{} `firestore:"_value,omitempty" json:"_value,omitempty"`
 }
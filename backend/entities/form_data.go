@@ -12,6 +12,12 @@ type PostgresFormData struct {
 	Port     int    `firestore:"pgport" json:"pgport"`
 	Schema   string `firestore:"pgschema" json:"pgschema"`
 	Username string `firestore:"pguser" json:"pguser"`
+
+	SSLMode string `firestore:"pgsslmode,omitempty" json:"pgsslmode,omitempty"`
+	//ConnectTimeout is in seconds
+	ConnectTimeout int `firestore:"pgconnecttimeout,omitempty" json:"pgconnecttimeout,omitempty"`
+	//Parameters are other libpq connection parameters
+	Parameters map[string]string `firestore:"pgparameters,omitempty" json:"pgparameters,omitempty"`
 }
 
 //ClickHouseFormData entity is stored in main storage (Firebase)
@@ -23,6 +29,13 @@ type ClickHouseFormData struct {
 	ChDb       string   `firestore:"ch_database" json:"ch_database"`
 	ChDsns     string   `firestore:"ch_dsns" json:"ch_dsns"`
 	ChDsnsList []string `firestore:"ch_dsns_list" json:"ch_dsns_list"`
+
+	//ChUser and ChPassword are put into DSNs which don't have credentials
+	ChUser     string `firestore:"ch_user,omitempty" json:"ch_user,omitempty"`
+	ChPassword string `firestore:"ch_password,omitempty" json:"ch_password,omitempty"`
+	//ChTls is TLS config name: CA certificate file path on EventNative server. DSNs use it with tls_config=name parameter.
+	//It is supported only in self-hosted installations (destinations.self_hosted)
+	ChTls map[string]string `firestore:"ch_tls,omitempty" json:"ch_tls,omitempty"`
 }
 
 //RedshiftFormData entity is stored in main storage (Firebase)
@@ -35,6 +48,11 @@ type RedshiftFormData struct {
 	Password string `firestore:"redshiftPassword" json:"redshiftPassword"`
 	Schema   string `firestore:"redshiftSchema" json:"redshiftSchema"`
 	Username string `firestore:"redshiftUser" json:"redshiftUser"`
+	//Port is 5439 by default
+	Port           int               `firestore:"redshiftPort,omitempty" json:"redshiftPort,omitempty"`
+	SSLMode        string            `firestore:"redshiftSSLMode,omitempty" json:"redshiftSSLMode,omitempty"`
+	ConnectTimeout int               `firestore:"redshiftConnectTimeout,omitempty" json:"redshiftConnectTimeout,omitempty"`
+	Parameters     map[string]string `firestore:"redshiftParameters,omitempty" json:"redshiftParameters,omitempty"`
 
 	S3AccessKey string `firestore:"redshiftS3AccessKey" json:"redshiftS3AccessKey"`
 	S3Bucket    string `firestore:"redshiftS3Bucket" json:"redshiftS3Bucket"`
@@ -71,6 +89,8 @@ type SnowflakeFormData struct {
 	S3Bucket    string `firestore:"snowflakeS3Bucket" json:"snowflakeS3Bucket"`
 	S3AccessKey string `firestore:"snowflakeS3AccessKey" json:"snowflakeS3AccessKey"`
 	S3SecretKey string `firestore:"snowflakeS3SecretKey" json:"snowflakeS3SecretKey"`
+	//UseHostedS3 stages batch files in the manager hosted S3 bucket instead of S3 or GCS from the form
+	UseHostedS3 bool `firestore:"snowflakeUseHostedS3,omitempty" json:"snowflakeUseHostedS3,omitempty"`
 
 	GCSBucket string      `firestore:"snowflakeGcsBucket" json:"snowflakeGcsBucket"`
 	GCSKey    interface{} `firestore:"snowflakeJSONKey" json:"snowflakeJSONKey"`
@@ -83,3 +103,18 @@ type GoogleAnalyticsFormData struct {
 
 	TrackingId string `firestore:"gaTrackingId" json:"gaTrackingId"`
 }
+
+//FileDumpFormData entity is stored in main storage (Firebase). Files are written in JSON with eventnative generated names
+type FileDumpFormData struct {
+	Mode string `firestore:"mode" json:"mode"`
+
+	UseHostedS3 bool   `firestore:"dumpUseHostedS3" json:"dumpUseHostedS3"`
+	S3Region    string `firestore:"dumpS3Region" json:"dumpS3Region"`
+	S3Bucket    string `firestore:"dumpS3Bucket" json:"dumpS3Bucket"`
+	S3Endpoint  string `firestore:"dumpS3Endpoint" json:"dumpS3Endpoint"`
+	S3AccessKey string `firestore:"dumpS3AccessKey" json:"dumpS3AccessKey"`
+	S3SecretKey string `firestore:"dumpS3SecretKey" json:"dumpS3SecretKey"`
+
+	//Folder is a plain path in the bucket. Hosted S3 files are put into <destination id>/<folder>
+	Folder string `firestore:"dumpFolder" json:"dumpFolder"`
+}
@@ -0,0 +1,106 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//Schedule is a period when a destination or an API key is disabled. Times are RFC3339 strings.
+//Empty DisableFrom means disabled until DisableTo, empty DisableTo means disabled since DisableFrom
+type Schedule struct {
+	DisableFrom string `firestore:"disableFrom,omitempty" json:"disableFrom,omitempty"`
+	DisableTo   string `firestore:"disableTo,omitempty" json:"disableTo,omitempty"`
+}
+
+//Validate return error if the schedule times are malformed or the period is empty
+func (s *Schedule) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.DisableFrom == "" && s.DisableTo == "" {
+		return errors.New("disableFrom or disableTo is required")
+	}
+
+	from, err := parseScheduleTime(s.DisableFrom)
+	if err != nil {
+		return fmt.Errorf("disableFrom must be RFC3339 time: %v", err)
+	}
+	to, err := parseScheduleTime(s.DisableTo)
+	if err != nil {
+		return fmt.Errorf("disableTo must be RFC3339 time: %v", err)
+	}
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return errors.New("disableTo must be after disableFrom")
+	}
+	return nil
+}
+
+//IsDisabled return true if the time is in the schedule period. Malformed schedule doesn't disable anything
+func (s *Schedule) IsDisabled(now time.Time) bool {
+	if s == nil || s.Validate() != nil {
+		return false
+	}
+	from, _ := parseScheduleTime(s.DisableFrom)
+	to, _ := parseScheduleTime(s.DisableTo)
+	return (from.IsZero() || !now.Before(from)) && (to.IsZero() || now.Before(to))
+}
+
+//NextChange return the first schedule period boundary after now or zero time if there isn't one
+func (s *Schedule) NextChange(now time.Time) time.Time {
+	if s == nil || s.Validate() != nil {
+		return time.Time{}
+	}
+	from, _ := parseScheduleTime(s.DisableFrom)
+	to, _ := parseScheduleTime(s.DisableTo)
+	for _, boundary := range []time.Time{from, to} {
+		if boundary.After(now) {
+			return boundary
+		}
+	}
+	return time.Time{}
+}
+
+//LastChange return the last schedule period boundary which isn't after now or zero time if there isn't one
+func (s *Schedule) LastChange(now time.Time) time.Time {
+	if s == nil || s.Validate() != nil {
+		return time.Time{}
+	}
+	from, _ := parseScheduleTime(s.DisableFrom)
+	to, _ := parseScheduleTime(s.DisableTo)
+	for _, boundary := range []time.Time{to, from} {
+		if !boundary.IsZero() && !boundary.After(now) {
+			return boundary
+		}
+	}
+	return time.Time{}
+}
+
+//LatestChange return the latest time
+func LatestChange(times ...time.Time) time.Time {
+	var latest time.Time
+	for _, t := range times {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+//EarliestChange return the earliest non zero time
+func EarliestChange(times ...time.Time) time.Time {
+	var earliest time.Time
+	for _, t := range times {
+		if !t.IsZero() && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+func parseScheduleTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
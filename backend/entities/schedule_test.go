@@ -0,0 +1,94 @@
+package entities
+
+import (
+	"testing"
+	"time"
+)
+
+func scheduleTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleIsDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      string
+		expected bool
+	}{
+		{"nil schedule", nil, "2021-01-01T12:00:00Z", false},
+		{"malformed schedule", &Schedule{DisableFrom: "tomorrow"}, "2021-01-01T12:00:00Z", false},
+		{"empty period", &Schedule{DisableFrom: "2021-01-02T00:00:00Z", DisableTo: "2021-01-01T00:00:00Z"}, "2021-01-01T12:00:00Z", false},
+		{"before period", &Schedule{DisableFrom: "2021-01-01T10:00:00Z", DisableTo: "2021-01-01T14:00:00Z"}, "2021-01-01T09:59:59Z", false},
+		{"period start", &Schedule{DisableFrom: "2021-01-01T10:00:00Z", DisableTo: "2021-01-01T14:00:00Z"}, "2021-01-01T10:00:00Z", true},
+		{"period end", &Schedule{DisableFrom: "2021-01-01T10:00:00Z", DisableTo: "2021-01-01T14:00:00Z"}, "2021-01-01T14:00:00Z", false},
+		{"open start", &Schedule{DisableTo: "2021-01-01T14:00:00Z"}, "2020-01-01T00:00:00Z", true},
+		{"open end", &Schedule{DisableFrom: "2021-01-01T10:00:00Z"}, "2030-01-01T00:00:00Z", true},
+		{"other time zone", &Schedule{DisableFrom: "2021-01-01T12:00:00+02:00"}, "2021-01-01T10:00:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.schedule.IsDisabled(scheduleTime(tt.now)); actual != tt.expected {
+				t.Errorf("IsDisabled() = %v, expected %v", actual, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScheduleChanges(t *testing.T) {
+	schedule := &Schedule{DisableFrom: "2021-01-01T10:00:00Z", DisableTo: "2021-01-01T14:00:00Z"}
+	tests := []struct {
+		now  string
+		next string
+		last string
+	}{
+		{"2021-01-01T09:00:00Z", "2021-01-01T10:00:00Z", ""},
+		{"2021-01-01T10:00:00Z", "2021-01-01T14:00:00Z", "2021-01-01T10:00:00Z"},
+		{"2021-01-01T12:00:00Z", "2021-01-01T14:00:00Z", "2021-01-01T10:00:00Z"},
+		{"2021-01-01T14:00:00Z", "", "2021-01-01T14:00:00Z"},
+		{"2021-01-02T00:00:00Z", "", "2021-01-01T14:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.now, func(t *testing.T) {
+			now := scheduleTime(tt.now)
+			checkChange(t, "NextChange", schedule.NextChange(now), tt.next)
+			checkChange(t, "LastChange", schedule.LastChange(now), tt.last)
+		})
+	}
+
+	var nilSchedule *Schedule
+	checkChange(t, "NextChange", nilSchedule.NextChange(time.Now()), "")
+	checkChange(t, "LastChange", nilSchedule.LastChange(time.Now()), "")
+	checkChange(t, "NextChange", (&Schedule{DisableTo: "bad"}).NextChange(time.Time{}), "")
+}
+
+func TestEarliestAndLatestChange(t *testing.T) {
+	first, second := scheduleTime("2021-01-01T10:00:00Z"), scheduleTime("2021-01-01T14:00:00Z")
+
+	if actual := EarliestChange(time.Time{}, second, first); !actual.Equal(first) {
+		t.Errorf("EarliestChange() = %v, expected %v", actual, first)
+	}
+	if actual := LatestChange(second, time.Time{}, first); !actual.Equal(second) {
+		t.Errorf("LatestChange() = %v, expected %v", actual, second)
+	}
+	if actual := EarliestChange(time.Time{}); !actual.IsZero() {
+		t.Errorf("EarliestChange() = %v, expected zero time", actual)
+	}
+}
+
+func checkChange(t *testing.T, name string, actual time.Time, expected string) {
+	t.Helper()
+	if expected == "" {
+		if !actual.IsZero() {
+			t.Errorf("%s() = %v, expected zero time", name, actual)
+		}
+		return
+	}
+	if !actual.Equal(scheduleTime(expected)) {
+		t.Errorf("%s() = %v, expected %s", name, actual, expected)
+	}
+}
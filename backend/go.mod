@@ -3,8 +3,10 @@ module github.com/jitsucom/enhosted
 go 1.14
 
 require (
+	cloud.google.com/go/bigquery v1.8.0
 	cloud.google.com/go/firestore v1.3.0
 	firebase.google.com/go/v4 v4.1.0
+	github.com/aws/aws-sdk-go v1.34.0
 	github.com/bramvdbogaerde/go-scp v0.0.0-20200820121624-ded9ee94aef5
 	github.com/gin-contrib/static v0.0.0-20200916080430-d45d9a37d28e
 	github.com/gin-gonic/gin v1.6.3
@@ -13,6 +15,7 @@ require (
 	github.com/jitsucom/eventnative v1.25.0
 	github.com/lib/pq v1.8.0
 	github.com/prometheus/common v0.15.0
+	github.com/snowflakedb/gosnowflake v1.3.8
 	github.com/spf13/viper v1.7.1
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
 	google.golang.org/api v0.29.0
@@ -2,43 +2,100 @@ package handlers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/authorization"
+	"github.com/jitsucom/enhosted/cache"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
 	"github.com/jitsucom/enhosted/storages"
 	enauth "github.com/jitsucom/eventnative/authorization"
 	"github.com/jitsucom/eventnative/logging"
 	enmiddleware "github.com/jitsucom/eventnative/middleware"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type ApiKeysHandler struct {
-	storage *storages.Firebase
+	storage storages.Storage
+	manager *storages.ApiKeysManager
+	payload *cache.Payload
 }
 
-func NewApiKeysHandler(storage *storages.Firebase) *ApiKeysHandler {
-	return &ApiKeysHandler{storage}
+func NewApiKeysHandler(storage storages.Storage, manager *storages.ApiKeysManager) *ApiKeysHandler {
+	akh := &ApiKeysHandler{storage: storage, manager: manager}
+	akh.payload = cache.NewPayload("api keys", akh.payloadVersion, akh.buildPayload)
+	akh.payload.InvalidateOn(storage.Changes().Subscribe(storages.ApiKeysCollection))
+	return akh
+}
+
+//Cache return tokens payload cache
+func (akh *ApiKeysHandler) Cache() *cache.Payload {
+	return akh.payload
 }
 
 func (akh *ApiKeysHandler) GetHandler(c *gin.Context) {
 	start := time.Now()
-	keys, err := akh.storage.GetApiKeys()
+	payload, err := akh.payload.Get()
 	if err != nil {
 		logging.Error(err)
 		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Error: err.Error(), Message: "Api keys err"})
 		return
 	}
 
+	logging.Infof("ApiKeys response in [%.2f] seconds", time.Now().Sub(start).Seconds())
+	c.JSON(http.StatusOK, payload)
+}
+
+//payloadVersion return API keys _lastUpdated
+func (akh *ApiKeysHandler) payloadVersion() (string, error) {
+	lastUpdated, err := akh.storage.GetApiKeysLastUpdated()
+	if err != nil {
+		return "", err
+	}
+	return lastUpdated.Format(storages.LastUpdatedLayout), nil
+}
+
+//buildPayload return all enabled API keys in eventnative format
+func (akh *ApiKeysHandler) buildPayload() (interface{}, error) {
+	keys, err := akh.storage.GetApiKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var nextScheduleChange, lastScheduleChange time.Time
 	var tokens []enauth.Token
 	for _, k := range keys {
+		if k.IsDeleted() {
+			continue
+		}
+		nextScheduleChange = entities.EarliestChange(nextScheduleChange, k.NextChange(now))
+		lastScheduleChange = entities.LatestChange(lastScheduleChange, k.LastChange(now))
+		if !k.IsEnabled(now) {
+			continue
+		}
 		tokens = append(tokens, enauth.Token{
 			Id:           k.Id,
 			ClientSecret: k.ClientSecret,
 			ServerSecret: k.ServerSecret,
 			Origins:      k.Origins,
 		})
+		//previous secrets are served as tokens with the same id so events are routed to the same destinations
+		for _, secrets := range k.ValidPreviousSecrets(now) {
+			tokens = append(tokens, enauth.Token{
+				Id:           k.Id,
+				ClientSecret: secrets.ClientSecret,
+				ServerSecret: secrets.ServerSecret,
+				Origins:      k.Origins,
+			})
+		}
 	}
 
-	logging.Infof("ApiKeys response in [%.2f] seconds", time.Now().Sub(start).Seconds())
-	c.JSON(http.StatusOK, &enauth.TokensPayload{Tokens: tokens})
+	//payload is rebuilt when a key is enabled or disabled by its schedule, expires or its previous secrets expire
+	akh.payload.ExpireAt(nextScheduleChange)
+	//EventNative If-Modified-Since requests get the rebuilt payload after the change
+	akh.payload.ChangedAt(lastScheduleChange)
+	return &enauth.TokensPayload{Tokens: tokens}, nil
 }
 
 type ApiKeyCreationRequest struct {
@@ -72,3 +129,226 @@ func (akh *ApiKeysHandler) CreateDefaultApiKeyHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, enmiddleware.OkResponse())
 }
+
+//ApiKeyRequest is a request body of API key lifecycle endpoints. Id is required for changing of existing keys
+type ApiKeyRequest struct {
+	ProjectId string   `json:"projectId"`
+	Id        string   `json:"id"`
+	Label     string   `json:"label"`
+	Origins   []string `json:"origins"`
+	//ExpiresAt is RFC3339 key expiration time
+	ExpiresAt string `json:"expiresAt"`
+	//GracePeriod is a duration (e.g. 24h) when old secrets stay valid after rotation. The configured one is used if it is empty
+	GracePeriod string `json:"gracePeriod"`
+}
+
+//ListHandler return all project API keys including deleted and revoked ones: GET /apikeys/list?project_id=
+//Secrets of revoked keys and previous secrets are masked
+func (akh *ApiKeysHandler) ListHandler(c *gin.Context) {
+	projectId := c.Query("project_id")
+	if projectId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[project_id] is a required query parameter"})
+		return
+	}
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + projectId})
+		return
+	}
+
+	keys, err := akh.manager.List(projectId)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get API keys", Error: err.Error()})
+		return
+	}
+	masked := make([]*entities.ApiKey, 0, len(keys))
+	for _, apiKey := range keys {
+		masked = append(masked, maskRetiredSecrets(apiKey))
+	}
+	c.JSON(http.StatusOK, &entities.ApiKeys{Keys: masked})
+}
+
+//CreateHandler generate a new API key: POST /apikeys {"projectId": "", "label": "", "origins": [], "expiresAt": ""}
+func (akh *ApiKeysHandler) CreateHandler(c *gin.Context) {
+	body, ok := akh.bindRequest(c, false)
+	if !ok {
+		return
+	}
+
+	apiKey, err := akh.manager.Create(body.ProjectId, body.Label, body.Origins, body.ExpiresAt)
+	akh.respond(c, body, apiKey, err)
+}
+
+//UpdateOriginsHandler replace the API key origins: PUT /apikeys {"projectId": "", "id": "<key uid>", "origins": []}
+func (akh *ApiKeysHandler) UpdateOriginsHandler(c *gin.Context) {
+	body, ok := akh.bindRequest(c, true)
+	if !ok {
+		return
+	}
+
+	apiKey, err := akh.manager.UpdateOrigins(body.ProjectId, body.Id, body.Origins)
+	akh.respond(c, body, apiKey, err)
+}
+
+//ExpirationHandler set or remove (if expiresAt is empty) the API key expiration time:
+//POST /apikeys/expiration {"projectId": "", "id": "<key uid>", "expiresAt": ""}
+func (akh *ApiKeysHandler) ExpirationHandler(c *gin.Context) {
+	body, ok := akh.bindRequest(c, true)
+	if !ok {
+		return
+	}
+
+	apiKey, err := akh.manager.SetExpiration(body.ProjectId, body.Id, body.ExpiresAt)
+	akh.respond(c, body, apiKey, err)
+}
+
+//RotateHandler regenerate the API key secrets. Old secrets stay valid during the grace period:
+//POST /apikeys/rotate {"projectId": "", "id": "<key uid>", "gracePeriod": "24h"}
+func (akh *ApiKeysHandler) RotateHandler(c *gin.Context) {
+	body, ok := akh.bindRequest(c, true)
+	if !ok {
+		return
+	}
+
+	var gracePeriod *time.Duration
+	if body.GracePeriod != "" {
+		duration, err := time.ParseDuration(body.GracePeriod)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[gracePeriod] must be a duration e.g. 24h", Error: err.Error()})
+			return
+		}
+		gracePeriod = &duration
+	}
+
+	apiKey, err := akh.manager.Rotate(body.ProjectId, body.Id, gracePeriod)
+	akh.respond(c, body, apiKey, err)
+}
+
+//RevokeHandler delete the API key permanently: POST /apikeys/revoke {"projectId": "", "id": "<key uid>"}
+func (akh *ApiKeysHandler) RevokeHandler(c *gin.Context) {
+	body, ok := akh.bindRequest(c, true)
+	if !ok {
+		return
+	}
+
+	if err := akh.manager.Revoke(body.ProjectId, body.Id); err != nil {
+		akh.respond(c, body, nil, err)
+		return
+	}
+	c.JSON(http.StatusOK, enmiddleware.OkResponse())
+}
+
+//bindRequest parse request body and check project access. Write error response and return false if the request is invalid
+func (akh *ApiKeysHandler) bindRequest(c *gin.Context, idRequired bool) (*ApiKeyRequest, bool) {
+	body := &ApiKeyRequest{}
+	if err := c.BindJSON(body); err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to parse request body", Error: err.Error()})
+		return nil, false
+	}
+	if body.ProjectId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[projectId] is a required field of request body"})
+		return nil, false
+	}
+	if idRequired && body.Id == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[id] is a required field of request body"})
+		return nil, false
+	}
+	if !authorization.HasAccessToProject(c, body.ProjectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + body.ProjectId})
+		return nil, false
+	}
+	return body, true
+}
+
+//respond write the changed API key or the error. Secrets replaced by rotation are masked: only the new secrets
+//of created and rotated keys are returned in full
+func (akh *ApiKeysHandler) respond(c *gin.Context, body *ApiKeyRequest, apiKey *entities.ApiKey, err error) {
+	if invalidErr, ok := err.(*storages.InvalidApiKeyError); ok {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Invalid API key request", Error: invalidErr.Error()})
+		return
+	}
+
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, maskRetiredSecrets(apiKey))
+	case storages.ErrNoFound:
+		c.JSON(http.StatusNotFound, enmiddleware.ErrorResponse{Message: "Project " + body.ProjectId + " doesn't have API key " + body.Id})
+	case storages.ErrApiKeyRevoked:
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "API key " + body.Id + " is revoked", Error: err.Error()})
+	default:
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to update API key", Error: err.Error()})
+	}
+}
+
+//LeakReport is a secret found by a secret scanner
+type LeakReport struct {
+	Token  string `json:"token"`
+	Type   string `json:"type"`
+	Url    string `json:"url"`
+	Source string `json:"source"`
+}
+
+//LeakReportResult is a result of one reported secret: revoked or not_found. Token is masked
+type LeakReportResult struct {
+	Token  string `json:"token"`
+	KeyId  string `json:"keyId,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+//LeakReportHandler revoke API keys which secrets were found by a secret scanner:
+//POST /apikeys/leaks [{"token": "js.<project id>....", "type": "", "url": "where the secret was found", "source": ""}]
+func (akh *ApiKeysHandler) LeakReportHandler(c *gin.Context) {
+	var reports []*LeakReport
+	if err := c.BindJSON(&reports); err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to parse request body", Error: err.Error()})
+		return
+	}
+
+	results := make([]*LeakReportResult, 0, len(reports))
+	for _, report := range reports {
+		result := &LeakReportResult{Token: maskSecret(report.Token), Status: "revoked"}
+		results = append(results, result)
+
+		source := strings.TrimSpace(report.Source + " " + report.Url)
+		keyId, err := akh.manager.RevokeLeaked(report.Token, source)
+		switch err {
+		case nil:
+			result.KeyId = keyId
+		case storages.ErrNoFound:
+			result.Status = "not_found"
+		default:
+			logging.Errorf("Error revoking leaked API key secret [%s]: %v", result.Token, err)
+			result.Status = "error"
+			result.Error = err.Error()
+		}
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+//maskRetiredSecrets return the API key copy where secrets of the revoked key and all previous secrets are masked
+func maskRetiredSecrets(apiKey *entities.ApiKey) *entities.ApiKey {
+	masked := *apiKey
+	if masked.IsRevoked() {
+		masked.ClientSecret = maskSecret(masked.ClientSecret)
+		masked.ServerSecret = maskSecret(masked.ServerSecret)
+	}
+	masked.PreviousSecrets = nil
+	for _, previous := range apiKey.PreviousSecrets {
+		masked.PreviousSecrets = append(masked.PreviousSecrets, &entities.PreviousSecrets{
+			ClientSecret: maskSecret(previous.ClientSecret),
+			ServerSecret: maskSecret(previous.ServerSecret),
+			ExpiresAt:    previous.ExpiresAt,
+		})
+	}
+	return &masked
+}
+
+//maskSecret return the secret with only prefix and project id shown
+func maskSecret(secret string) string {
+	if i := strings.LastIndex(secret, "."); i >= 0 {
+		return secret[:i+1] + destinations.SecretMask
+	}
+	return destinations.SecretMask
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"testing"
+)
+
+func TestMaskRetiredSecrets(t *testing.T) {
+	previous := []*entities.PreviousSecrets{{ClientSecret: "js.project.oldclient", ServerSecret: "s2s.project.oldserver", ExpiresAt: "2021-01-02T00:00:00Z"}}
+	active := &entities.ApiKey{Id: "active", ClientSecret: "js.project.client", ServerSecret: "s2s.project.server", PreviousSecrets: previous}
+	revoked := &entities.ApiKey{Id: "revoked", ClientSecret: "js.project.client2", ServerSecret: "s2s.project.server2",
+		RevokedAt: "2021-01-01T00:00:00.000Z", DeletedAt: "2021-01-01T00:00:00.000Z"}
+
+	masked := maskRetiredSecrets(active)
+	if masked.ClientSecret != "js.project.client" || masked.ServerSecret != "s2s.project.server" {
+		t.Errorf("active key secrets must be kept: %+v", masked)
+	}
+	if len(masked.PreviousSecrets) != 1 {
+		t.Fatalf("expected 1 previous secrets, got %d", len(masked.PreviousSecrets))
+	}
+	if p := masked.PreviousSecrets[0]; p.ClientSecret != "js.project.********" || p.ServerSecret != "s2s.project.********" || p.ExpiresAt != "2021-01-02T00:00:00Z" {
+		t.Errorf("previous secrets must be masked: %+v", p)
+	}
+	if previous[0].ClientSecret != "js.project.oldclient" {
+		t.Error("stored key must not be changed")
+	}
+
+	masked = maskRetiredSecrets(revoked)
+	if masked.ClientSecret != "js.project.********" || masked.ServerSecret != "s2s.project.********" {
+		t.Errorf("revoked key secrets must be masked: %+v", masked)
+	}
+	if revoked.ClientSecret != "js.project.client2" {
+		t.Error("stored key must not be changed")
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/cache"
+	"net/http"
+)
+
+type CacheStatsResponse struct {
+	Caches []cache.Stats `json:"caches"`
+}
+
+//CacheHandler reports in-process payloads caches hits and rebuild times
+type CacheHandler struct {
+	payloads []*cache.Payload
+}
+
+func NewCacheHandler(payloads ...*cache.Payload) *CacheHandler {
+	return &CacheHandler{payloads: payloads}
+}
+
+func (ch *CacheHandler) GetHandler(c *gin.Context) {
+	response := CacheStatsResponse{Caches: []cache.Stats{}}
+	for _, payload := range ch.payloads {
+		response.Caches = append(response.Caches, payload.Stats())
+	}
+	c.JSON(http.StatusOK, response)
+}
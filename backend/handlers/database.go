@@ -10,19 +10,19 @@ import (
 	"net/http"
 )
 
-var systemErrProjectId = fmt.Errorf("System error: %s wasn't found in context" + middleware.ProjectIdKey)
+var systemErrProjectId = fmt.Errorf("System error: %s wasn't found in context", middleware.ProjectIdKey)
 
 const jsonContentType = "application/json"
 
 type DatabaseHandler struct {
-	storage *storages.Firebase
+	storage storages.Storage
 }
 
 type DbCreationRequestBody struct {
 	ProjectId string `json:"projectId"`
 }
 
-func NewDatabaseHandler(storage *storages.Firebase) *DatabaseHandler {
+func NewDatabaseHandler(storage storages.Storage) *DatabaseHandler {
 	return &DatabaseHandler{storage: storage}
 }
 
@@ -61,3 +61,11 @@ func extractProjectId(c *gin.Context) string {
 	}
 	return iface.(string)
 }
+
+func extractUserId(c *gin.Context) string {
+	iface, ok := c.Get(middleware.UserIdKey)
+	if !ok {
+		return ""
+	}
+	return iface.(string)
+}
@@ -2,104 +2,438 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/authorization"
+	"github.com/jitsucom/enhosted/cache"
+	"github.com/jitsucom/enhosted/connection"
 	"github.com/jitsucom/enhosted/destinations"
 	"github.com/jitsucom/enhosted/entities"
 	"github.com/jitsucom/enhosted/eventnative"
 	"github.com/jitsucom/enhosted/middleware"
+	"github.com/jitsucom/enhosted/random"
 	"github.com/jitsucom/enhosted/storages"
 	enadapters "github.com/jitsucom/eventnative/adapters"
 	endestinations "github.com/jitsucom/eventnative/destinations"
 	"github.com/jitsucom/eventnative/logging"
 	enmiddleware "github.com/jitsucom/eventnative/middleware"
 	enstorages "github.com/jitsucom/eventnative/storages"
+	"github.com/jitsucom/eventnative/timestamp"
+	"gopkg.in/yaml.v3"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	defaultStatisticsPostgresDestinationId = "statistics.postgres"
+	destinationUidLength                   = 21
+	defaultDryRunLimit                     = 20
 )
 
+//ValidationErrorResponse is returned when destination form data has invalid fields
+type ValidationErrorResponse struct {
+	Message string                        `json:"message"`
+	Errors  destinations.ValidationErrors `json:"errors"`
+}
+
 type DestinationsHandler struct {
-	storage            *storages.Firebase
+	storage            storages.Storage
+	history            *storages.DestinationsHistory
 	defaultS3          *enadapters.S3Config
 	statisticsPostgres *enstorages.DestinationConfig
 
 	enService *eventnative.Service
+	payload   *cache.Payload
+	health    *destinations.Health
 }
 
-func NewDestinationsHandler(storage *storages.Firebase, defaultS3 *enadapters.S3Config, statisticsPostgres *enstorages.DestinationConfig,
-	enService *eventnative.Service) *DestinationsHandler {
-	return &DestinationsHandler{
+func NewDestinationsHandler(storage storages.Storage, history *storages.DestinationsHistory, defaultS3 *enadapters.S3Config,
+	statisticsPostgres *enstorages.DestinationConfig, enService *eventnative.Service, health *destinations.Health) *DestinationsHandler {
+	dh := &DestinationsHandler{
 		storage:            storage,
+		history:            history,
 		defaultS3:          defaultS3,
 		statisticsPostgres: statisticsPostgres,
 		enService:          enService,
+		health:             health,
 	}
+	dh.payload = cache.NewPayload("destinations", dh.payloadVersion, dh.buildPayload)
+	//destinations payload depends on project API keys (only tokens)
+	dh.payload.InvalidateOn(storage.Changes().Subscribe(storages.DestinationsCollection, storages.ApiKeysCollection))
+	return dh
+}
+
+//Cache return destinations payload cache
+func (dh *DestinationsHandler) Cache() *cache.Payload {
+	return dh.payload
 }
 
 func (dh *DestinationsHandler) GetHandler(c *gin.Context) {
 	start := time.Now()
-	destinationsMap, err := dh.storage.GetDestinations()
+	payload, err := dh.payload.Get()
 	if err != nil {
 		logging.Error(err)
 		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Error: err.Error(), Message: "Destinations err"})
 		return
 	}
 
+	logging.Infof("Destinations response in [%.2f] seconds", time.Now().Sub(start).Seconds())
+	c.JSON(http.StatusOK, payload)
+}
+
+//payloadVersion return destinations and API keys _lastUpdated
+func (dh *DestinationsHandler) payloadVersion() (string, error) {
+	destinationsLastUpdated, err := dh.storage.GetDestinationsLastUpdated()
+	if err != nil {
+		return "", err
+	}
+	apiKeysLastUpdated, err := dh.storage.GetApiKeysLastUpdated()
+	if err != nil {
+		return "", err
+	}
+
+	return destinationsLastUpdated.Format(storages.LastUpdatedLayout) + "|" + apiKeysLastUpdated.Format(storages.LastUpdatedLayout), nil
+}
+
+//buildPayload return all projects destinations mapped into eventnative format
+func (dh *DestinationsHandler) buildPayload() (interface{}, error) {
+	destinationsMap, err := dh.storage.GetDestinations()
+	if err != nil {
+		return nil, err
+	}
+
 	idConfig := map[string]enstorages.DestinationConfig{}
 	keysByProject, err := dh.storage.GetApiKeysGroupByProjectId()
 	if err != nil {
-		logging.Errorf("Error getting api keys grouped by project id. All destinations will be skipped: %v", err)
-		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Error: err.Error(), Message: "Failed to get API keys"})
-		return
+		return nil, fmt.Errorf("Error getting api keys grouped by project id. All destinations will be skipped: %v", err)
 	}
+	now := time.Now().UTC()
+	//payload is rebuilt when a destination or an API key is enabled or disabled by its schedule or an API key expires.
+	//Last change is used as Last-Modified so EventNative gets the rebuilt payload
+	var nextScheduleChange, lastScheduleChange time.Time
+	for _, keys := range keysByProject {
+		for _, k := range keys {
+			if !k.IsDeleted() {
+				nextScheduleChange = entities.EarliestChange(nextScheduleChange, k.NextChange(now))
+				lastScheduleChange = entities.LatestChange(lastScheduleChange, k.LastChange(now))
+			}
+		}
+	}
+
+	statuses := map[string][]*destinations.DestinationStatus{}
 	for projectId, destinationsEntity := range destinationsMap {
 		if len(destinationsEntity.Destinations) == 0 {
 			continue
 		}
 
 		//if only tokens empty - put all tokens by project
-		keys, ok := keysByProject[projectId]
-		if !ok {
+		projectTokenIds := activeTokenIds(keysByProject[projectId], now)
+		if len(projectTokenIds) == 0 {
 			logging.Errorf("No API keys for project [%s], all destinations will be skipped", projectId)
-			continue
 		}
 
-		if len(keys) == 0 {
-			continue
-		}
+		for _, destination := range destinationsEntity.Destinations {
+			if destination.IsDeleted() {
+				continue
+			}
+			nextScheduleChange = entities.EarliestChange(nextScheduleChange, destination.Schedule.NextChange(now))
+			lastScheduleChange = entities.LatestChange(lastScheduleChange, destination.LastChange(now))
 
-		var projectTokenIds []string
-		for _, k := range keys {
-			projectTokenIds = append(projectTokenIds, k.Id)
-		}
+			status := &destinations.DestinationStatus{Uid: destination.Uid, Id: destination.Id, Type: destination.Type, Healthy: true}
+			statuses[projectId] = append(statuses[projectId], status)
+			if !destination.IsEnabled(now) {
+				status.Disabled = true
+				continue
+			}
+			if len(projectTokenIds) == 0 {
+				status.Healthy = false
+				status.Reason = "Project doesn't have enabled API keys"
+				continue
+			}
 
-		for _, destination := range destinationsEntity.Destinations {
-			destinationId := projectId + "." + destination.Uid
-			enDestinationConfig, err := destinations.MapConfig(destinationId, destination, dh.defaultS3)
+			destinationId, enDestinationConfig, err := mapDestination(projectId, destination, projectTokenIds, dh.defaultS3)
 			if err != nil {
 				logging.Errorf("Error mapping destination config for destination type: %s id: %s projectId: %s err: %v", destination.Type, destination.Uid, projectId, err)
+				status.Healthy = false
+				status.Reason = "Error mapping destination config: " + err.Error()
 				continue
 			}
-
-			if len(destination.OnlyKeys) > 0 {
-				enDestinationConfig.OnlyTokens = destination.OnlyKeys
-			} else {
-				enDestinationConfig.OnlyTokens = projectTokenIds
-			}
 			idConfig[destinationId] = *enDestinationConfig
 		}
 	}
+	dh.health.Update(statuses)
+	dh.payload.ExpireAt(nextScheduleChange)
+	dh.payload.ChangedAt(lastScheduleChange)
 	if dh.statisticsPostgres != nil {
 		//default statistic storage
 		idConfig[defaultStatisticsPostgresDestinationId] = *dh.statisticsPostgres
 	}
 
-	logging.Infof("Destinations response in [%.2f] seconds", time.Now().Sub(start).Seconds())
-	c.JSON(http.StatusOK, &endestinations.Payload{Destinations: idConfig})
+	return &endestinations.Payload{Destinations: idConfig}, nil
+}
+
+//PreviewResponse is eventnative config of one destination with masked secrets
+type PreviewResponse struct {
+	Id       string                        `json:"id"`
+	Config   *enstorages.DestinationConfig `json:"config"`
+	Warnings []string                      `json:"warnings,omitempty"`
+}
+
+//PreviewHandler return eventnative config of the destination exactly as GetHandler serves it but with masked secrets:
+//POST /destinations/preview?project_id=[&format=yaml]
+//If the destination doesn't have _uid (not created yet) a random one is used so hosted S3 folder is an example
+func (dh *DestinationsHandler) PreviewHandler(c *gin.Context) {
+	projectId, destination, ok := dh.parseWriteRequest(c)
+	if !ok {
+		return
+	}
+	if !validateDestination(c, destination) {
+		return
+	}
+	if destination.Uid == "" {
+		destination.Uid = random.LowerCaseString(destinationUidLength)
+	}
+
+	keys, err := dh.storage.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get API keys", Error: err.Error()})
+		return
+	}
+	now := time.Now().UTC()
+	projectTokenIds := activeTokenIds(keys, now)
+	var warnings []string
+	if len(projectTokenIds) == 0 {
+		warnings = append(warnings, "Project doesn't have enabled API keys: the destination won't be served to EventNative")
+	}
+	if !destination.IsEnabled(now) {
+		warnings = append(warnings, "Destination is disabled: it won't be served to EventNative")
+	}
+	activeIds := map[string]bool{}
+	for _, keyId := range projectTokenIds {
+		activeIds[keyId] = true
+	}
+	for _, keyId := range destination.OnlyKeys {
+		if !activeIds[keyId] {
+			warnings = append(warnings, fmt.Sprintf("API key [%s] from _onlyKeys doesn't exist, is deleted or disabled", keyId))
+		}
+	}
+
+	masked, err := destinations.MaskSecrets(destination)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to mask destination secrets", Error: err.Error()})
+		return
+	}
+	var maskedS3 *enadapters.S3Config
+	if dh.defaultS3 != nil {
+		s3 := *dh.defaultS3
+		s3.SecretKey = destinations.SecretMask
+		maskedS3 = &s3
+	}
+	destinationId, config, err := mapDestination(projectId, masked, projectTokenIds, maskedS3)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Invalid destination config", Error: err.Error()})
+		return
+	}
+
+	if c.Query("format") != "yaml" {
+		c.JSON(http.StatusOK, PreviewResponse{Id: destinationId, Config: config, Warnings: warnings})
+		return
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}{"destinations": map[string]*enstorages.DestinationConfig{destinationId: config}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to serialize destination config", Error: err.Error()})
+		return
+	}
+	previewYaml := yaml.Node{}
+	if err := yaml.Unmarshal(b, &previewYaml); err != nil {
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to serialize destination config", Error: err.Error()})
+		return
+	}
+	previewYaml.HeadComment = strings.Join(warnings, "\n")
+
+	c.Header("Content-Type", "application/yaml")
+	encoder := yaml.NewEncoder(c.Writer)
+	defer encoder.Close()
+
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&previewYaml); err != nil {
+		logging.Errorf("Error writing destination preview: %v", err)
+	}
+}
+
+//DryRunResponse is mapping dry-run result per event. Failed is the number of events with mapping errors
+type DryRunResponse struct {
+	Events []*destinations.DryRunEvent `json:"events"`
+	Failed int                         `json:"failed"`
+}
+
+//DryRunHandler apply the draft destination mapping rules and table name template to the project last cached events:
+//POST /destinations/dry_run?project_id=[&limit=20&start=&end=]
+//Events of the destination are used if it has been already created otherwise events of all project destinations
+func (dh *DestinationsHandler) DryRunHandler(c *gin.Context) {
+	projectId, destination, ok := dh.parseWriteRequest(c)
+	if !ok {
+		return
+	}
+	if !validateDestination(c, destination) {
+		return
+	}
+
+	limit := defaultDryRunLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limitInt, err := strconv.Atoi(limitStr)
+		if err != nil || limitInt <= 0 {
+			c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[limit] must be a positive integer"})
+			return
+		}
+		limit = limitInt
+	}
+	start := c.Query("start")
+	if start == "" {
+		start = time.Time{}.Format(timestamp.Layout)
+	}
+	end := c.Query("end")
+	if end == "" {
+		end = time.Now().UTC().Format(timestamp.Layout)
+	}
+
+	//secrets aren't needed for mapping
+	masked, err := destinations.MaskSecrets(destination)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to mask destination secrets", Error: err.Error()})
+		return
+	}
+	config, err := destinations.MapConfig(projectId+"."+destination.Uid, masked, dh.defaultS3)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Invalid destination config", Error: err.Error()})
+		return
+	}
+
+	var destinationIds []string
+	if destination.Uid != "" {
+		destinationIds = append(destinationIds, projectId+"."+destination.Uid)
+	} else {
+		projectDestinations, err := dh.storage.GetDestinationsByProjectId(projectId)
+		if err != nil {
+			logging.Error(err)
+			c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get destinations", Error: err.Error()})
+			return
+		}
+		for _, projectDestination := range projectDestinations {
+			if !projectDestination.IsDeleted() {
+				destinationIds = append(destinationIds, projectId+"."+projectDestination.Uid)
+			}
+		}
+	}
+	if len(destinationIds) == 0 {
+		c.JSON(http.StatusOK, DryRunResponse{Events: []*destinations.DryRunEvent{}})
+		return
+	}
+
+	cachedEvents, err := dh.enService.GetLastEvents(strings.Join(destinationIds, ","), start, end, limit)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get events from EventNative", Error: err.Error()})
+		return
+	}
+
+	//the same event might be cached for several destinations
+	var objects []map[string]interface{}
+	seen := map[string]bool{}
+	for _, cachedEvent := range cachedEvents.Events {
+		if len(cachedEvent.Original) == 0 || seen[string(cachedEvent.Original)] {
+			continue
+		}
+		seen[string(cachedEvent.Original)] = true
+
+		object := map[string]interface{}{}
+		if err := json.Unmarshal(cachedEvent.Original, &object); err != nil {
+			logging.Errorf("Error parsing cached event of [%s] project: %v", projectId, err)
+			continue
+		}
+		objects = append(objects, object)
+	}
+
+	result, err := destinations.DryRun(config, objects)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Invalid destination mapping", Error: err.Error()})
+		return
+	}
+	response := DryRunResponse{Events: result}
+	if response.Events == nil {
+		response.Events = []*destinations.DryRunEvent{}
+	}
+	for _, event := range response.Events {
+		if event.Error != "" {
+			response.Failed++
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+//mapDestination return eventnative destination id and config. If the destination doesn't have only keys all project tokens are used
+func mapDestination(projectId string, destination *entities.Destination, projectTokenIds []string, defaultS3 *enadapters.S3Config) (string, *enstorages.DestinationConfig, error) {
+	destinationId := projectId + "." + destination.Uid
+	enDestinationConfig, err := destinations.MapConfig(destinationId, destination, defaultS3)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(destination.OnlyKeys) > 0 {
+		enDestinationConfig.OnlyTokens = destination.OnlyKeys
+	} else {
+		enDestinationConfig.OnlyTokens = projectTokenIds
+	}
+	return destinationId, enDestinationConfig, nil
+}
+
+//activeTokenIds return ids of not deleted and enabled API keys
+func activeTokenIds(keys []*entities.ApiKey, now time.Time) []string {
+	var ids []string
+	for _, k := range keys {
+		if k.IsDeleted() || !k.IsEnabled(now) {
+			continue
+		}
+		ids = append(ids, k.Id)
+	}
+	return ids
+}
+
+//StatusHandler return the project destinations statuses: which destinations are served to EventNative and why others are skipped:
+//GET /destinations/status?project_id=
+func (dh *DestinationsHandler) StatusHandler(c *gin.Context) {
+	projectId := c.Query("project_id")
+	if projectId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[project_id] is a required query parameter"})
+		return
+	}
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + projectId})
+		return
+	}
+
+	//statuses are recorded on payload build
+	if _, err := dh.payload.Get(); err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to build destinations payload", Error: err.Error()})
+		return
+	}
+
+	status := dh.health.Get(projectId)
+	if status == nil {
+		status = &destinations.ProjectStatus{CheckedAt: time.Now().UTC(), Destinations: []*destinations.DestinationStatus{}}
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+//TypesHandler return form data schemas of all supported destination types
+func (dh *DestinationsHandler) TypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, destinations.Types())
 }
 
 func (dh *DestinationsHandler) TestHandler(c *gin.Context) {
@@ -110,6 +444,10 @@ func (dh *DestinationsHandler) TestHandler(c *gin.Context) {
 		return
 	}
 
+	if !validateDestination(c, destinationEntity) {
+		return
+	}
+
 	enDestinationConfig, err := destinations.MapConfig("test_connection", destinationEntity, dh.defaultS3)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: fmt.Sprintf("Failed to map [%s] firebase config to eventnative format", destinationEntity.Type), Error: err.Error()})
@@ -141,3 +479,258 @@ func (dh *DestinationsHandler) TestHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to write response", Error: err.Error()})
 	}
 }
+
+//DiagnosticsResponse is a response of GET /destinations/test/diagnostics
+type DiagnosticsResponse struct {
+	Tests []*entities.ConnectionTest `json:"tests"`
+}
+
+//DiagnoseHandler run the deep connection test step by step (DNS, TCP, auth, schema, create table, insert/read, staging, EventNative)
+//and return every step result with timing: POST /destinations/test/diagnostics?project_id=
+//The result is stored as the last test of the destination if the project has the destination with the _uid
+func (dh *DestinationsHandler) DiagnoseHandler(c *gin.Context) {
+	projectId, destination, ok := dh.parseWriteRequest(c)
+	if !ok {
+		return
+	}
+	if !validateDestination(c, destination) {
+		return
+	}
+
+	destinationId := "test_connection"
+	if destination.Uid != "" {
+		destinationId = projectId + "." + destination.Uid
+	}
+	enDestinationConfig, err := destinations.MapConfig(destinationId, destination, dh.defaultS3)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: fmt.Sprintf("Failed to map [%s] firebase config to eventnative format", destination.Type), Error: err.Error()})
+		return
+	}
+
+	test := connection.Diagnose(c.Request.Context(), destination.Uid, enDestinationConfig, func() error {
+		return dh.testInEventnative(enDestinationConfig)
+	})
+
+	if destination.Uid != "" {
+		projectDestinations, err := dh.storage.GetDestinationsByProjectId(projectId)
+		if err != nil {
+			logging.Errorf("Error getting destinations of [%s] project for saving connection test: %v", projectId, err)
+		} else if findDestinationByUid(projectDestinations, destination.Uid) != nil {
+			if err := dh.storage.SaveConnectionTest(projectId, test); err != nil {
+				logging.Errorf("Error saving connection test of [%s] destination: %v", destination.Uid, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, test)
+}
+
+//LastTestsHandler return the last deep connection tests of the project destinations: GET /destinations/test/diagnostics?project_id=
+func (dh *DestinationsHandler) LastTestsHandler(c *gin.Context) {
+	projectId := c.Query("project_id")
+	if projectId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[project_id] is a required query parameter"})
+		return
+	}
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + projectId})
+		return
+	}
+
+	tests, err := dh.storage.GetConnectionTests(projectId)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get connection tests", Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, DiagnosticsResponse{Tests: tests})
+}
+
+//testInEventnative send the config to EventNative /destinations/test and return error with EventNative message if the test failed
+func (dh *DestinationsHandler) testInEventnative(config *enstorages.DestinationConfig) error {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("Failed to serialize destination config: %v", err)
+	}
+
+	code, content, err := dh.enService.TestDestination(b)
+	if err != nil {
+		return fmt.Errorf("Failed to get response from eventnative: %v", err)
+	}
+	if code == http.StatusOK {
+		return nil
+	}
+
+	errorResponse := &enmiddleware.ErrorResponse{}
+	if err := json.Unmarshal(content, errorResponse); err == nil && errorResponse.Message != "" {
+		if errorResponse.Error != "" {
+			return fmt.Errorf("%s: %s", errorResponse.Message, errorResponse.Error)
+		}
+		return errors.New(errorResponse.Message)
+	}
+	return fmt.Errorf("EventNative response code [%d]: %s", code, string(content))
+}
+
+//CreateHandler add a new destination into the project: POST /destinations?project_id=
+//_uid is generated, destinations _lastUpdated is updated
+func (dh *DestinationsHandler) CreateHandler(c *gin.Context) {
+	projectId, destination, ok := dh.parseWriteRequest(c)
+	if !ok {
+		return
+	}
+
+	projectDestinations, err := dh.storage.GetDestinationsByProjectId(projectId)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get destinations", Error: err.Error()})
+		return
+	}
+	if existing := findDestinationById(projectDestinations, destination.Id); existing != nil {
+		c.JSON(http.StatusConflict, enmiddleware.ErrorResponse{Message: fmt.Sprintf("Destination with [_id] %s already exists", destination.Id)})
+		return
+	}
+
+	destination.Uid = random.LowerCaseString(destinationUidLength)
+	if !dh.validate(c, projectId, destination) {
+		return
+	}
+
+	dh.save(c, projectId, append(projectDestinations, destination), destination.Uid, "create destination "+destination.Uid)
+}
+
+//UpdateHandler replace the project destination with the same _uid: PUT /destinations?project_id=
+func (dh *DestinationsHandler) UpdateHandler(c *gin.Context) {
+	projectId, destination, ok := dh.parseWriteRequest(c)
+	if !ok {
+		return
+	}
+	if destination.Uid == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[_uid] is a required field of request body"})
+		return
+	}
+
+	projectDestinations, err := dh.storage.GetDestinationsByProjectId(projectId)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get destinations", Error: err.Error()})
+		return
+	}
+	index := -1
+	for i, existing := range projectDestinations {
+		if existing.Uid == destination.Uid && !existing.IsDeleted() {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		c.JSON(http.StatusNotFound, enmiddleware.ErrorResponse{Message: "Project " + projectId + " doesn't have destination " + destination.Uid})
+		return
+	}
+	if existing := findDestinationById(projectDestinations, destination.Id); existing != nil && existing.Uid != destination.Uid {
+		c.JSON(http.StatusConflict, enmiddleware.ErrorResponse{Message: fmt.Sprintf("Destination with [_id] %s already exists", destination.Id)})
+		return
+	}
+
+	destination, err = destinations.MergeSecrets(destination, projectDestinations[index])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to merge destination secrets", Error: err.Error()})
+		return
+	}
+	if !dh.validate(c, projectId, destination) {
+		return
+	}
+
+	projectDestinations[index] = destination
+	dh.save(c, projectId, projectDestinations, destination.Uid, "update destination "+destination.Uid)
+}
+
+//parseWriteRequest return project id and destination from create/update request or write error response
+func (dh *DestinationsHandler) parseWriteRequest(c *gin.Context) (string, *entities.Destination, bool) {
+	projectId := c.Query("project_id")
+	if projectId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[project_id] is a required query parameter"})
+		return "", nil, false
+	}
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + projectId})
+		return "", nil, false
+	}
+
+	destination := &entities.Destination{}
+	if err := c.BindJSON(destination); err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to parse request body", Error: err.Error()})
+		return "", nil, false
+	}
+	if destination.Id == "" || destination.Type == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[_id] and [_type] are required fields of request body"})
+		return "", nil, false
+	}
+	//tombstones are managed only by delete/restore requests
+	destination.DeletedAt = ""
+
+	return projectId, destination, true
+}
+
+//validate check destination form data and that the destination might be mapped into eventnative config or write error response
+func (dh *DestinationsHandler) validate(c *gin.Context, projectId string, destination *entities.Destination) bool {
+	if !validateDestination(c, destination) {
+		return false
+	}
+
+	if _, err := destinations.MapConfig(projectId+"."+destination.Uid, destination, dh.defaultS3); err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Invalid destination config", Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+//save write project destinations with a new revision and write the saved destination as response
+func (dh *DestinationsHandler) save(c *gin.Context, projectId string, projectDestinations []*entities.Destination, uid, comment string) {
+	revision, err := dh.history.Save(projectId, projectDestinations, extractUserId(c), comment)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to save destinations", Error: err.Error()})
+		return
+	}
+
+	for _, saved := range revision.Destinations {
+		if saved.Uid == uid {
+			c.JSON(http.StatusOK, saved)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, middleware.OkResponse{Status: "ok"})
+}
+
+//validateDestination write field errors response if the destination form data is invalid
+func validateDestination(c *gin.Context, destination *entities.Destination) bool {
+	if err := destinations.Validate(destination); err != nil {
+		if validationErrors, ok := err.(destinations.ValidationErrors); ok {
+			c.JSON(http.StatusBadRequest, ValidationErrorResponse{Message: "Invalid destination config", Errors: validationErrors})
+		} else {
+			c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Invalid destination config", Error: err.Error()})
+		}
+		return false
+	}
+	return true
+}
+
+//findDestinationById return not deleted destination with the _id or nil
+func findDestinationById(projectDestinations []*entities.Destination, id string) *entities.Destination {
+	for _, destination := range projectDestinations {
+		if destination.Id == id && !destination.IsDeleted() {
+			return destination
+		}
+	}
+	return nil
+}
+
+//findDestinationByUid return not deleted destination with the _uid or nil
+func findDestinationByUid(projectDestinations []*entities.Destination, uid string) *entities.Destination {
+	for _, destination := range projectDestinations {
+		if destination.Uid == uid && !destination.IsDeleted() {
+			return destination
+		}
+	}
+	return nil
+}
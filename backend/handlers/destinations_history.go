@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/authorization"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/storages"
+	"github.com/jitsucom/eventnative/logging"
+	enmiddleware "github.com/jitsucom/eventnative/middleware"
+	"net/http"
+)
+
+type DestinationsHistoryResponse struct {
+	Revisions []*entities.DestinationsRevision `json:"revisions"`
+}
+
+type RollbackRequest struct {
+	ProjectId  string `json:"projectId"`
+	RevisionId string `json:"revisionId"`
+}
+
+type DestinationsHistoryHandler struct {
+	history *storages.DestinationsHistory
+}
+
+func NewDestinationsHistoryHandler(history *storages.DestinationsHistory) *DestinationsHistoryHandler {
+	return &DestinationsHistoryHandler{history: history}
+}
+
+func (dhh *DestinationsHistoryHandler) GetHandler(c *gin.Context) {
+	projectId := c.Query("project_id")
+	if projectId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[project_id] is a required query parameter"})
+		return
+	}
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + projectId})
+		return
+	}
+
+	revisions, err := dhh.history.Revisions(projectId)
+	if err != nil {
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to get destinations history", Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, DestinationsHistoryResponse{Revisions: revisions})
+}
+
+func (dhh *DestinationsHistoryHandler) RollbackHandler(c *gin.Context) {
+	body := &RollbackRequest{}
+	if err := c.BindJSON(body); err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to parse request body", Error: err.Error()})
+		return
+	}
+	if body.ProjectId == "" || body.RevisionId == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[projectId] and [revisionId] are required fields of request body"})
+		return
+	}
+	if !authorization.HasAccessToProject(c, body.ProjectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + body.ProjectId})
+		return
+	}
+
+	revision, err := dhh.history.Rollback(body.ProjectId, body.RevisionId, extractUserId(c))
+	if err != nil {
+		if err == storages.ErrNoFound {
+			c.JSON(http.StatusNotFound, enmiddleware.ErrorResponse{Message: "Revision " + body.RevisionId + " wasn't found"})
+			return
+		}
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to rollback destinations", Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/storages"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testProjectId = "project"
+
+//newTestDestinationsHandler return handler on a temporary local storage
+func newTestDestinationsHandler(t *testing.T) (*DestinationsHandler, func()) {
+	dir, err := ioutil.TempDir("", "destinations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := storages.NewLocal(filepath.Join(dir, "db.json"), nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	history := storages.NewDestinationsHistory(storage)
+	return NewDestinationsHandler(storage, history, nil, nil, nil, nil), func() {
+		history.Close()
+		storage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+//serveWrite run the write handler with the destination as request body and return response code
+func serveWrite(t *testing.T, handler gin.HandlerFunc, destination interface{}) int {
+	b, err := json.Marshal(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/destinations?project_id="+testProjectId, bytes.NewReader(b))
+	c.Set("_project_id", testProjectId)
+	handler(c)
+	return w.Code
+}
+
+func testPostgresDestination(uid string, data map[string]interface{}) *entities.Destination {
+	formData := map[string]interface{}{"pghost": "pg.example.com", "pgdatabase": "db", "pguser": "user"}
+	for k, v := range data {
+		formData[k] = v
+	}
+	return &entities.Destination{Uid: uid, Id: "pg", Type: "postgres", Data: formData}
+}
+
+func storedFormData(t *testing.T, dh *DestinationsHandler) map[string]interface{} {
+	stored, err := dh.storage.GetDestinationsByProjectId(testProjectId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("expected 1 destination, got %d", len(stored))
+	}
+	return stored[0].Data.(map[string]interface{})
+}
+
+func TestCreateDestinationValidation(t *testing.T) {
+	dh, cleanup := newTestDestinationsHandler(t)
+	defer cleanup()
+
+	invalid := &entities.Destination{Id: "pg", Type: "postgres", Data: map[string]interface{}{"pghost": "pg.example.com"}}
+	if code := serveWrite(t, dh.CreateHandler, invalid); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid form data, got %d", code)
+	}
+	if code := serveWrite(t, dh.CreateHandler, &entities.Destination{Id: "pg", Type: "mysql", Data: map[string]interface{}{}}); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown type, got %d", code)
+	}
+	if code := serveWrite(t, dh.CreateHandler, testPostgresDestination("", nil)); code != http.StatusOK {
+		t.Fatalf("expected 200 for valid destination, got %d", code)
+	}
+	if code := serveWrite(t, dh.CreateHandler, testPostgresDestination("", nil)); code != http.StatusConflict {
+		t.Errorf("expected 409 for duplicate _id, got %d", code)
+	}
+}
+
+func TestUpdateDestinationKeepsSecrets(t *testing.T) {
+	dh, cleanup := newTestDestinationsHandler(t)
+	defer cleanup()
+
+	if _, err := dh.history.Save(testProjectId, []*entities.Destination{testPostgresDestination("uid", map[string]interface{}{"pgpassword": "secret"})}, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	masked := testPostgresDestination("uid", map[string]interface{}{"pghost": "new.example.com", "pgpassword": "********"})
+	if code := serveWrite(t, dh.UpdateHandler, masked); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if data := storedFormData(t, dh); data["pgpassword"] != "secret" || data["pghost"] != "new.example.com" {
+		t.Errorf("masked secret must be kept: %v", data)
+	}
+
+	if code := serveWrite(t, dh.UpdateHandler, testPostgresDestination("uid", nil)); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if data := storedFormData(t, dh); data["pgpassword"] != "secret" {
+		t.Errorf("omitted secret must be kept: %v", data)
+	}
+
+	if code := serveWrite(t, dh.UpdateHandler, testPostgresDestination("uid", map[string]interface{}{"pgpassword": "new"})); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if data := storedFormData(t, dh); data["pgpassword"] != "new" {
+		t.Errorf("secret must be updated: %v", data)
+	}
+
+	invalid := testPostgresDestination("uid", map[string]interface{}{"pgport": "5432"})
+	if code := serveWrite(t, dh.UpdateHandler, invalid); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid form data, got %d", code)
+	}
+	if code := serveWrite(t, dh.UpdateHandler, testPostgresDestination("unknown", nil)); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown destination, got %d", code)
+	}
+}
+
+func destinationStatuses(t *testing.T, dh *DestinationsHandler) map[string]*destinations.DestinationStatus {
+	w := serveConfig(dh.StatusHandler, testProjectId, "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	status := &destinations.ProjectStatus{}
+	if err := json.Unmarshal(w.Body.Bytes(), status); err != nil {
+		t.Fatal(err)
+	}
+	result := map[string]*destinations.DestinationStatus{}
+	for _, destinationStatus := range status.Destinations {
+		result[destinationStatus.Uid] = destinationStatus
+	}
+	return result
+}
+
+func TestDestinationsStatus(t *testing.T) {
+	dh, cleanup := newTestDestinationsHandler(t)
+	defer cleanup()
+	dh.health = destinations.NewHealth(false)
+
+	disabled := false
+	projectDestinations := []*entities.Destination{
+		testPostgresDestination("healthy", map[string]interface{}{"mode": "stream"}),
+		{Uid: "paused", Id: "paused", Type: "postgres", Enabled: &disabled},
+		{Uid: "unknown", Id: "unknown", Type: "unknown"},
+		{Uid: "deleted", Id: "deleted", Type: "postgres", DeletedAt: "2021-01-02T00:00:00.000Z"},
+	}
+	if _, err := dh.history.Save(testProjectId, projectDestinations, "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+
+	//all destinations are skipped without API keys
+	statuses := destinationStatuses(t, dh)
+	if len(statuses) != 3 {
+		t.Fatalf("expected statuses of 3 not deleted destinations, got %+v", statuses)
+	}
+	if status := statuses["healthy"]; status.Healthy || status.Reason != "Project doesn't have enabled API keys" {
+		t.Errorf("expected destination skipped without API keys, got %+v", status)
+	}
+	since := statuses["healthy"].Since
+
+	if err := dh.storage.CreateDefaultApiKey(testProjectId); err != nil {
+		t.Fatal(err)
+	}
+	statuses = destinationStatuses(t, dh)
+	if status := statuses["healthy"]; !status.Healthy || status.Reason != "" || !status.Since.After(since) {
+		t.Errorf("expected healthy destination since API key creation, got %+v", status)
+	}
+	if status := statuses["paused"]; !status.Healthy || !status.Disabled {
+		t.Errorf("expected disabled destination, got %+v", status)
+	}
+	if status := statuses["unknown"]; status.Healthy || status.Reason == "" {
+		t.Errorf("expected skipped destination with mapping error, got %+v", status)
+	}
+}
@@ -23,12 +23,13 @@ log:
 `
 
 type ConfigHandler struct {
-	fb        *storages.Firebase
+	storage   storages.Storage
+	history   *storages.DestinationsHistory
 	defaultS3 *enadapters.S3Config
 }
 
-func NewConfigurationHandler(fb *storages.Firebase, s3 *enadapters.S3Config) (*ConfigHandler, error) {
-	return &ConfigHandler{fb: fb, defaultS3: s3}, nil
+func NewConfigurationHandler(storage storages.Storage, history *storages.DestinationsHistory, s3 *enadapters.S3Config) (*ConfigHandler, error) {
+	return &ConfigHandler{storage: storage, history: history, defaultS3: s3}, nil
 }
 
 type Server struct {
@@ -52,19 +53,28 @@ func (ch *ConfigHandler) Handler(c *gin.Context) {
 		return
 	}
 
-	keys, err := ch.fb.GetApiKeysByProjectId(projectId)
+	projectKeys, err := ch.storage.GetApiKeysByProjectId(projectId)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to get API keys"})
 		return
 	}
+	var keys []*entities.ApiKey
+	for _, apiKey := range projectKeys {
+		if !apiKey.IsDeleted() {
+			keys = append(keys, apiKey)
+		}
+	}
 
-	projectDestinations, err := ch.fb.GetDestinationsByProjectId(projectId)
+	projectDestinations, err := ch.storage.GetDestinationsByProjectId(projectId)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to get Destinations"})
 		return
 	}
 	mappedDestinations := make(map[string]*enstorages.DestinationConfig)
 	for _, destination := range projectDestinations {
+		if destination.IsDeleted() {
+			continue
+		}
 		id := destination.Id
 		config, err := destinations.MapConfig(id, destination, ch.defaultS3)
 
@@ -72,6 +82,8 @@ func (ch *ConfigHandler) Handler(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to build destinations response"})
 			return
 		}
+		//API keys restriction is exported so the configuration import keeps it
+		config.OnlyTokens = destination.OnlyKeys
 		mappedDestinations[id] = config
 	}
 
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/authorization"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/random"
+	"github.com/jitsucom/enhosted/storages"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/middleware"
+	enstorages "github.com/jitsucom/eventnative/storages"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+//import change actions
+const (
+	importCreate    = "create"
+	importUpdate    = "update"
+	importUnchanged = "unchanged"
+)
+
+//ImportConfig is eventnative YAML configuration: server.auth tokens and destinations
+type ImportConfig struct {
+	Server struct {
+		Auth yaml.Node `yaml:"auth"`
+	} `yaml:"server"`
+	Destinations map[string]*enstorages.DestinationConfig `yaml:"destinations"`
+}
+
+//ImportChange is a change of one API key or destination. Invalid entities have Error or Errors
+type ImportChange struct {
+	Id     string                        `json:"id"`
+	Type   string                        `json:"type,omitempty"`
+	Action string                        `json:"action,omitempty"`
+	Error  string                        `json:"error,omitempty"`
+	Errors destinations.ValidationErrors `json:"errors,omitempty"`
+}
+
+//ImportResponse is returned from ImportHandler in both preview and apply modes
+type ImportResponse struct {
+	Preview      bool            `json:"preview"`
+	ApiKeys      []*ImportChange `json:"apiKeys"`
+	Destinations []*ImportChange `json:"destinations"`
+}
+
+func (ir *ImportResponse) hasErrors() bool {
+	for _, change := range append(ir.ApiKeys, ir.Destinations...) {
+		if change.Error != "" || len(change.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//ImportHandler import eventnative YAML configuration (server.auth and destinations) into the project:
+//POST /eventnative/configuration/import?project_id=[&preview=true]
+//Destinations and API keys are matched by id: existing are updated, others are created. Nothing is deleted.
+//In preview mode changes are only returned. Nothing is saved if there are invalid entities
+func (ch *ConfigHandler) ImportHandler(c *gin.Context) {
+	projectId := c.Query("project_id")
+	if projectId == "" {
+		c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Message: "[project_id] query parameter absents"})
+		return
+	}
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, middleware.ErrorResponse{Message: "You are not authorized to request data for project " + projectId})
+		return
+	}
+	preview := c.Query("preview") == "true"
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Message: "Failed to read request body", Error: err.Error()})
+		return
+	}
+	importConfig := &ImportConfig{}
+	if err := yaml.Unmarshal(body, importConfig); err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Message: "Failed to parse eventnative YAML configuration", Error: err.Error()})
+		return
+	}
+	importKeys, err := parseAuthTokens(&importConfig.Server.Auth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, middleware.ErrorResponse{Message: "Failed to parse server.auth", Error: err.Error()})
+		return
+	}
+
+	projectKeys, err := ch.storage.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to get API keys"})
+		return
+	}
+	projectDestinations, err := ch.storage.GetDestinationsByProjectId(projectId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to get Destinations"})
+		return
+	}
+
+	response := &ImportResponse{Preview: preview, ApiKeys: []*ImportChange{}, Destinations: []*ImportChange{}}
+	mergedKeys, keysChanged := ch.mergeApiKeys(projectId, projectKeys, importKeys, response)
+	mergedDestinations, destinationsChanged := ch.mergeDestinations(projectDestinations, importConfig.Destinations, response)
+
+	if response.hasErrors() {
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if preview {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if keysChanged {
+		if err := ch.storage.UpdateApiKeys(projectId, &entities.ApiKeys{LastUpdated: time.Now().UTC().Format(storages.LastUpdatedLayout), Keys: mergedKeys}); err != nil {
+			logging.Error(err)
+			c.JSON(http.StatusInternalServerError, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to save API keys"})
+			return
+		}
+	}
+	if destinationsChanged {
+		if _, err := ch.history.Save(projectId, mergedDestinations, extractUserId(c), "import eventnative configuration"); err != nil {
+			logging.Error(err)
+			c.JSON(http.StatusInternalServerError, middleware.ErrorResponse{Error: err.Error(), Message: "Failed to save destinations"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+//mergeApiKeys return project keys with imported ones and true if there are changes. Keys without id are matched by secrets
+func (ch *ConfigHandler) mergeApiKeys(projectId string, projectKeys, importKeys []*entities.ApiKey, response *ImportResponse) ([]*entities.ApiKey, bool) {
+	merged := append([]*entities.ApiKey{}, projectKeys...)
+	changed := false
+	for _, importKey := range importKeys {
+		index := -1
+		for i, projectKey := range merged {
+			if (importKey.Id != "" && projectKey.Id == importKey.Id) ||
+				(importKey.Id == "" && projectKey.ClientSecret == importKey.ClientSecret && projectKey.ServerSecret == importKey.ServerSecret) {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			if importKey.Id == "" {
+				importKey.Id = projectId + "." + random.String(6)
+			}
+			merged = append(merged, importKey)
+			response.ApiKeys = append(response.ApiKeys, &ImportChange{Id: importKey.Id, Action: importCreate})
+			changed = true
+			continue
+		}
+
+		existing := merged[index]
+		importKey.Id = existing.Id
+		if existing.ClientSecret == importKey.ClientSecret && existing.ServerSecret == importKey.ServerSecret &&
+			reflect.DeepEqual(existing.Origins, importKey.Origins) && !existing.IsDeleted() {
+			response.ApiKeys = append(response.ApiKeys, &ImportChange{Id: importKey.Id, Action: importUnchanged})
+			continue
+		}
+		//EventNative config doesn't have label, enabled flag, schedule and expiration so they are kept
+		importKey.Label = existing.Label
+		importKey.Enabled = existing.Enabled
+		importKey.Schedule = existing.Schedule
+		importKey.ExpiresAt = existing.ExpiresAt
+		merged[index] = importKey
+		response.ApiKeys = append(response.ApiKeys, &ImportChange{Id: importKey.Id, Action: importUpdate})
+		changed = true
+	}
+	return merged, changed
+}
+
+//mergeDestinations return project destinations with imported ones and true if there are changes. Destinations are matched by _id
+func (ch *ConfigHandler) mergeDestinations(projectDestinations []*entities.Destination, importConfigs map[string]*enstorages.DestinationConfig, response *ImportResponse) ([]*entities.Destination, bool) {
+	var ids []string
+	for id := range importConfigs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	merged := append([]*entities.Destination{}, projectDestinations...)
+	changed := false
+	for _, id := range ids {
+		change := &ImportChange{Id: id}
+		response.Destinations = append(response.Destinations, change)
+
+		if importConfigs[id] == nil {
+			change.Error = "destination config is empty"
+			continue
+		}
+		destination, err := destinations.UnmapConfig(id, importConfigs[id], ch.defaultS3)
+		if err != nil {
+			change.Error = err.Error()
+			continue
+		}
+		change.Type = destination.Type
+		if err := destinations.Validate(destination); err != nil {
+			if validationErrors, ok := err.(destinations.ValidationErrors); ok {
+				change.Errors = validationErrors
+			} else {
+				change.Error = err.Error()
+			}
+			continue
+		}
+
+		existing := findDestinationById(merged, id)
+		if existing == nil {
+			destination.Uid = random.LowerCaseString(destinationUidLength)
+			merged = append(merged, destination)
+			change.Action = importCreate
+			changed = true
+			continue
+		}
+
+		if destinations.SameDestination(existing, destination) {
+			change.Action = importUnchanged
+			continue
+		}
+		destination.Uid = existing.Uid
+		destination.Comment = existing.Comment
+		destination.Enabled = existing.Enabled
+		destination.Schedule = existing.Schedule
+		for i := range merged {
+			if merged[i] == existing {
+				merged[i] = destination
+			}
+		}
+		change.Action = importUpdate
+		changed = true
+	}
+	return merged, changed
+}
+
+//parseAuthTokens return API keys of eventnative server.auth: a list of token objects or a list of client secrets
+func parseAuthTokens(auth *yaml.Node) ([]*entities.ApiKey, error) {
+	if auth.Kind == 0 {
+		return nil, nil
+	}
+	if auth.Kind != yaml.SequenceNode {
+		return nil, errors.New("server.auth must be a list of tokens. Tokens URL or file path can't be imported")
+	}
+
+	var keys []*entities.ApiKey
+	for i, item := range auth.Content {
+		apiKey := &entities.ApiKey{}
+		switch item.Kind {
+		case yaml.ScalarNode:
+			//eventnative treats plain string tokens as client secrets
+			apiKey.ClientSecret = item.Value
+		case yaml.MappingNode:
+			if err := item.Decode(apiKey); err != nil {
+				return nil, fmt.Errorf("token %d: %v", i, err)
+			}
+		default:
+			return nil, fmt.Errorf("token %d must be a string or an object", i)
+		}
+		if apiKey.ClientSecret == "" && apiKey.ServerSecret == "" {
+			return nil, fmt.Errorf("token %d must have client_secret or server_secret", i)
+		}
+		keys = append(keys, apiKey)
+	}
+	return keys, nil
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//serveConfig run the configuration handler of the project with raw request body and return the response
+func serveConfig(handler gin.HandlerFunc, projectId, query string, body []byte) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/eventnative/configuration?project_id="+projectId+query, bytes.NewReader(body))
+	c.Set("_project_id", projectId)
+	handler(c)
+	return w
+}
+
+func parseImportResponse(t *testing.T, w *httptest.ResponseRecorder) *ImportResponse {
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	response := &ImportResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestConfigurationImportRoundTrip(t *testing.T) {
+	dh, cleanup := newTestDestinationsHandler(t)
+	defer cleanup()
+	ch, _ := NewConfigurationHandler(dh.storage, dh.history, nil)
+
+	keys := []*entities.ApiKey{{Id: "project.key", ClientSecret: "js.project.secret", ServerSecret: "s2s.project.secret", Origins: []string{"example.com"}}}
+	if err := dh.storage.UpdateApiKeys(testProjectId, &entities.ApiKeys{LastUpdated: "2021-01-02T00:00:00.000Z", Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	destination := testPostgresDestination("uid", map[string]interface{}{"mode": "stream", "pgport": 5432, "pgpassword": "secret"})
+	destination.Mappings = entities.Mappings{KeepFields: true, Rules: []entities.MapRule{
+		{Action: destinations.MoveAction, SourceField: "/src", DestinationField: "/dst"},
+		{Action: "cast/int", SourceField: "/count", DestinationField: "/count"},
+		{Action: destinations.ConstantAction, DestinationField: "/source", Value: "web"},
+	}}
+	destination.OnlyKeys = []string{"project.key"}
+	if _, err := dh.history.Save(testProjectId, []*entities.Destination{destination}, "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := serveConfig(ch.Handler, testProjectId, "", nil)
+	if exported.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", exported.Code, exported.Body.String())
+	}
+	configYaml := exported.Body.Bytes()
+
+	//importing of the exported configuration doesn't change the project
+	response := parseImportResponse(t, serveConfig(ch.ImportHandler, testProjectId, "&preview=true", configYaml))
+	if len(response.ApiKeys) != 1 || response.ApiKeys[0].Action != importUnchanged {
+		t.Errorf("expected unchanged API key, got %+v", response.ApiKeys)
+	}
+	if len(response.Destinations) != 1 || response.Destinations[0].Action != importUnchanged {
+		t.Errorf("expected unchanged destination, got %+v", response.Destinations)
+	}
+
+	//importing into another project creates the same entities
+	response = parseImportResponse(t, serveConfig(ch.ImportHandler, "another", "", configYaml))
+	if len(response.Destinations) != 1 || response.Destinations[0].Action != importCreate {
+		t.Fatalf("expected created destination, got %+v", response.Destinations)
+	}
+	imported, err := dh.storage.GetDestinationsByProjectId("another")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 1 || !destinations.SameDestination(imported[0], destination) {
+		t.Errorf("imported destination %+v differs from exported %+v", imported, destination)
+	}
+	importedKeys, err := dh.storage.GetApiKeysByProjectId("another")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(importedKeys) != 1 || importedKeys[0].ClientSecret != keys[0].ClientSecret || importedKeys[0].ServerSecret != keys[0].ServerSecret {
+		t.Errorf("unexpected imported API keys: %+v", importedKeys)
+	}
+
+	//changed destination is updated
+	changedYaml := bytes.Replace(configYaml, []byte("pg.example.com"), []byte("changed.example.com"), 1)
+	response = parseImportResponse(t, serveConfig(ch.ImportHandler, testProjectId, "&preview=true", changedYaml))
+	if len(response.Destinations) != 1 || response.Destinations[0].Action != importUpdate {
+		t.Errorf("expected updated destination, got %+v", response.Destinations)
+	}
+}
+
+func TestConfigurationImportInvalid(t *testing.T) {
+	dh, cleanup := newTestDestinationsHandler(t)
+	defer cleanup()
+	ch, _ := NewConfigurationHandler(dh.storage, dh.history, nil)
+
+	configYaml := []byte(`
+server:
+  auth:
+    - js.project.secret
+destinations:
+  pg:
+    type: postgres
+    datasource:
+      host: pg.example.com
+`)
+	w := serveConfig(ch.ImportHandler, testProjectId, "", configYaml)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid destination, got %d: %s", w.Code, w.Body.String())
+	}
+	if keys, _ := dh.storage.GetApiKeysByProjectId(testProjectId); len(keys) != 0 {
+		t.Errorf("nothing must be saved if there are invalid entities, got API keys %+v", keys)
+	}
+
+	if w := serveConfig(ch.ImportHandler, testProjectId, "", []byte("server:\n  auth: https://example.com/tokens\n")); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for tokens URL, got %d", w.Code)
+	}
+}
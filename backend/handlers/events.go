@@ -16,11 +16,11 @@ import (
 )
 
 type EventsHandler struct {
-	storage   *storages.Firebase
+	storage   storages.Storage
 	enService *eventnative.Service
 }
 
-func NewEventsHandler(storage *storages.Firebase, enService *eventnative.Service) *EventsHandler {
+func NewEventsHandler(storage storages.Storage, enService *eventnative.Service) *EventsHandler {
 	return &EventsHandler{
 		storage:   storage,
 		enService: enService,
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/authorization"
+	"github.com/jitsucom/enhosted/middleware"
+	"github.com/jitsucom/enhosted/storages"
+	"github.com/jitsucom/eventnative/logging"
+	enmiddleware "github.com/jitsucom/eventnative/middleware"
+	"net/http"
+)
+
+type SoftDeletionRequest struct {
+	ProjectId string `json:"projectId"`
+	Id        string `json:"id"`
+}
+
+//SoftDeletionHandler deletes (puts tombstones) and restores destinations, API keys and custom domains
+type SoftDeletionHandler struct {
+	softDeletion *storages.SoftDeletion
+}
+
+func NewSoftDeletionHandler(softDeletion *storages.SoftDeletion) *SoftDeletionHandler {
+	return &SoftDeletionHandler{softDeletion: softDeletion}
+}
+
+//DeleteDestinationHandler soft delete destination: DELETE /destinations?project_id=&id=<destination _uid>
+func (sdh *SoftDeletionHandler) DeleteDestinationHandler(c *gin.Context) {
+	sdh.handleQuery(c, "destination", func(projectId, id string) error {
+		return sdh.softDeletion.DeleteDestination(projectId, id, extractUserId(c))
+	})
+}
+
+//RestoreDestinationHandler restore destination: POST /destinations/restore {"projectId": "", "id": "<destination _uid>"}
+func (sdh *SoftDeletionHandler) RestoreDestinationHandler(c *gin.Context) {
+	sdh.handleBody(c, "destination", func(projectId, id string) error {
+		return sdh.softDeletion.RestoreDestination(projectId, id, extractUserId(c))
+	})
+}
+
+//DeleteApiKeyHandler soft delete API key: DELETE /apikeys?project_id=&id=<key uid>
+func (sdh *SoftDeletionHandler) DeleteApiKeyHandler(c *gin.Context) {
+	sdh.handleQuery(c, "API key", sdh.softDeletion.DeleteApiKey)
+}
+
+//RestoreApiKeyHandler restore API key: POST /apikeys/restore {"projectId": "", "id": "<key uid>"}
+func (sdh *SoftDeletionHandler) RestoreApiKeyHandler(c *gin.Context) {
+	sdh.handleBody(c, "API key", sdh.softDeletion.RestoreApiKey)
+}
+
+//DeleteCustomDomainHandler soft delete custom domain: DELETE /domains?project_id=&id=<domain name>
+func (sdh *SoftDeletionHandler) DeleteCustomDomainHandler(c *gin.Context) {
+	sdh.handleQuery(c, "custom domain", sdh.softDeletion.DeleteCustomDomain)
+}
+
+//RestoreCustomDomainHandler restore custom domain: POST /domains/restore {"projectId": "", "id": "<domain name>"}
+func (sdh *SoftDeletionHandler) RestoreCustomDomainHandler(c *gin.Context) {
+	sdh.handleBody(c, "custom domain", sdh.softDeletion.RestoreCustomDomain)
+}
+
+func (sdh *SoftDeletionHandler) handleQuery(c *gin.Context, entity string, action func(projectId, id string) error) {
+	projectId := c.Query("project_id")
+	id := c.Query("id")
+	if projectId == "" || id == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[project_id] and [id] are required query parameters"})
+		return
+	}
+
+	sdh.handle(c, entity, projectId, id, action)
+}
+
+func (sdh *SoftDeletionHandler) handleBody(c *gin.Context, entity string, action func(projectId, id string) error) {
+	body := &SoftDeletionRequest{}
+	if err := c.BindJSON(body); err != nil {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Failed to parse request body", Error: err.Error()})
+		return
+	}
+	if body.ProjectId == "" || body.Id == "" {
+		c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "[projectId] and [id] are required fields of request body"})
+		return
+	}
+
+	sdh.handle(c, entity, body.ProjectId, body.Id, action)
+}
+
+func (sdh *SoftDeletionHandler) handle(c *gin.Context, entity, projectId, id string, action func(projectId, id string) error) {
+	if !authorization.HasAccessToProject(c, projectId) {
+		c.JSON(http.StatusUnauthorized, enmiddleware.ErrorResponse{Message: "User does not have access to project " + projectId})
+		return
+	}
+
+	if err := action(projectId, id); err != nil {
+		if err == storages.ErrNoFound {
+			c.JSON(http.StatusNotFound, enmiddleware.ErrorResponse{Message: "Project " + projectId + " doesn't have " + entity + " " + id})
+			return
+		}
+		if err == storages.ErrDestinationIdConflict {
+			c.JSON(http.StatusConflict, enmiddleware.ErrorResponse{Message: "Deleted " + entity + " " + id + " can't be restored", Error: err.Error()})
+			return
+		}
+		if err == storages.ErrApiKeyRevoked {
+			c.JSON(http.StatusBadRequest, enmiddleware.ErrorResponse{Message: "Revoked " + entity + " " + id + " can't be restored", Error: err.Error()})
+			return
+		}
+		logging.Error(err)
+		c.JSON(http.StatusInternalServerError, enmiddleware.ErrorResponse{Message: "Failed to update " + entity, Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, middleware.OkResponse{Status: "ok"})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/storages"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//restoreDestination run RestoreDestinationHandler with the project destination _uid and return response code
+func restoreDestination(t *testing.T, sdh *SoftDeletionHandler, projectId, uid string) int {
+	b, err := json.Marshal(&SoftDeletionRequest{ProjectId: projectId, Id: uid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/destinations/restore", bytes.NewReader(b))
+	c.Set("_project_id", projectId)
+	sdh.RestoreDestinationHandler(c)
+	return w.Code
+}
+
+func TestRestoreDestinationWithTakenId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soft_delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	storage, err := storages.NewLocal(filepath.Join(dir, "db.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	history := storages.NewDestinationsHistory(storage)
+	defer history.Close()
+	softDeletion := storages.NewSoftDeletion(storage, history, time.Hour)
+	defer softDeletion.Close()
+	sdh := NewSoftDeletionHandler(softDeletion)
+
+	deletedAt := time.Now().UTC().Format(storages.LastUpdatedLayout)
+	projectDestinations := []*entities.Destination{{Uid: "deleted", Id: "pg", DeletedAt: deletedAt}, {Uid: "alive", Id: "pg"}}
+	if _, err := history.Save("project", projectDestinations, "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := restoreDestination(t, sdh, "project", "deleted"); code != http.StatusConflict {
+		t.Errorf("expected 409 on restoring destination with taken [_id], got %d", code)
+	}
+	if code := restoreDestination(t, sdh, "project", "unknown"); code != http.StatusNotFound {
+		t.Errorf("expected 404 on restoring unknown destination, got %d", code)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/jitsucom/enhosted/middleware"
 	"github.com/jitsucom/enhosted/ssh"
 	"github.com/jitsucom/enhosted/ssl"
+	"github.com/jitsucom/enhosted/staging"
 	"github.com/jitsucom/enhosted/statistics"
 	"github.com/jitsucom/enhosted/storages"
 	enadapters "github.com/jitsucom/eventnative/adapters"
@@ -36,6 +37,21 @@ func main() {
 	flag.Parse()
 	readConfiguration(*configFilePath)
 
+	if err := destinations.InitSecrets(viper.Sub("secrets")); err != nil {
+		logging.Fatal("Failed to configure secrets master keys:", err)
+	}
+	//EventNative runs on the same hosts as the manager: destinations settings might refer to files on EventNative host
+	destinations.InitSelfHosted(viper.GetBool("destinations.self_hosted"))
+
+	switch flag.Arg(0) {
+	case migrateStorageCommand:
+		runStorageMigration(flag.Args()[1:])
+		return
+	case encryptSecretsCommand:
+		runSecretsEncryption(flag.Args()[1:])
+		return
+	}
+
 	//listen to shutdown signal to free up all resources
 	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
@@ -104,15 +120,28 @@ func main() {
 	}
 
 	//main storage
-	firebaseViper := viper.Sub("storage.firebase")
-	if firebaseViper == nil {
-		logging.Fatal("storage is not set properly. Only firebase is supported now")
-	}
-	firebaseStorage, err := storages.NewFirebase(ctx, firebaseViper, pgDestination)
+	mainStorage, err := storages.NewStorage(ctx, viper.Sub("storage"), pgDestination)
 	if err != nil {
-		logging.Fatal("Failed to create firebase storage: %s", err)
+		logging.Fatalf("Failed to create main storage: %v", err)
+	}
+	appconfig.Instance.ScheduleClosing(mainStorage)
+
+	destinationsHistory := storages.NewDestinationsHistory(mainStorage)
+	appconfig.Instance.ScheduleClosing(destinationsHistory)
+
+	softDeletion := storages.NewSoftDeletion(mainStorage, destinationsHistory, viper.GetDuration("soft_delete.retention"))
+	appconfig.Instance.ScheduleClosing(softDeletion)
+
+	apiKeysManager := storages.NewApiKeysManager(mainStorage, viper.GetDuration("api_keys.rotation_grace_period"), viper.GetBool("notifications.api_keys_expiration"))
+	appconfig.Instance.ScheduleClosing(apiKeysManager)
+
+	if stagingRetention := viper.GetDuration("destinations.hosted.staging_retention"); stagingRetention > 0 {
+		stagingCleaner, err := staging.NewCleaner(ctx, mainStorage, s3Config, stagingRetention)
+		if err != nil {
+			logging.Fatalf("Failed to create hosted staging cleaner: %v", err)
+		}
+		appconfig.Instance.ScheduleClosing(stagingCleaner)
 	}
-	appconfig.Instance.ScheduleClosing(firebaseStorage)
 
 	staticFilesPath := viper.GetString("server.static_files_dir")
 	logging.Infof("Static files serving path: [%s]", staticFilesPath)
@@ -150,7 +179,7 @@ func main() {
 		logging.Fatal("Failed to create SSH client, %s", err)
 	}
 
-	customDomainProcessor, err := ssl.NewCertificateService(sshClient, enConfig.SSL.Hosts, firebaseStorage, enConfig.SSL.ServerConfigTemplate, enConfig.SSL.NginxConfigPath, enConfig.SSL.AcmeChallengePath)
+	customDomainProcessor, err := ssl.NewCertificateService(sshClient, enConfig.SSL.Hosts, mainStorage, enConfig.SSL.ServerConfigTemplate, enConfig.SSL.NginxConfigPath, enConfig.SSL.AcmeChallengePath)
 
 	sslUpdateExecutor := ssl.NewSSLUpdateExecutor(customDomainProcessor, enConfig.SSL.Hosts, enConfig.SSL.SSH.User, enConfig.SSL.SSH.PrivateKeyPath, enConfig.CName, enConfig.SSL.CertificatePath, enConfig.SSL.PKPath, enConfig.SSL.AcmeChallengePath)
 
@@ -164,7 +193,7 @@ func main() {
 	enService := eventnative.NewService(enConfig.BaseUrl, enConfig.AdminToken)
 	appconfig.Instance.ScheduleClosing(enService)
 
-	router := SetupRouter(staticFilesPath, enService, firebaseStorage, authService, s3Config, pgDestinationConfig, statisticsStorage, sslUpdateExecutor)
+	router := SetupRouter(staticFilesPath, enService, mainStorage, destinationsHistory, softDeletion, apiKeysManager, authService, s3Config, pgDestinationConfig, statisticsStorage, sslUpdateExecutor)
 	notifications.ServerStart()
 	logging.Info("Started server: " + appconfig.Instance.Authority)
 	server := &http.Server{
@@ -195,7 +224,8 @@ func readConfiguration(configFilePath string) {
 }
 
 func SetupRouter(staticContentDirectory string, enService *eventnative.Service,
-	storage *storages.Firebase, authService *authorization.Service, defaultS3 *enadapters.S3Config,
+	storage storages.Storage, destinationsHistory *storages.DestinationsHistory, softDeletion *storages.SoftDeletion,
+	apiKeysManager *storages.ApiKeysManager, authService *authorization.Service, defaultS3 *enadapters.S3Config,
 	statisticsPostgres *enstorages.DestinationConfig, statisticsStorage statistics.Storage,
 	sslUpdateExecutor *ssl.UpdateExecutor) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
@@ -213,29 +243,64 @@ func SetupRouter(staticContentDirectory string, enService *eventnative.Service,
 	serverToken := viper.GetString("server.auth")
 
 	statisticsHandler := handlers.NewStatisticsHandler(statisticsStorage)
-	apiKeysHandler := handlers.NewApiKeysHandler(storage)
+	apiKeysHandler := handlers.NewApiKeysHandler(storage, apiKeysManager)
+	softDeletionHandler := handlers.NewSoftDeletionHandler(softDeletion)
 
 	apiV1 := router.Group("/api/v1")
 	{
 		apiV1.POST("/database", middleware.ClientAuth(handlers.NewDatabaseHandler(storage).PostHandler, authService))
 		apiV1.POST("/apikeys/default", middleware.ClientAuth(apiKeysHandler.CreateDefaultApiKeyHandler, authService))
+		apiV1.GET("/apikeys/list", middleware.ClientAuth(apiKeysHandler.ListHandler, authService))
+		apiV1.POST("/apikeys", middleware.ClientAuth(apiKeysHandler.CreateHandler, authService))
+		apiV1.PUT("/apikeys", middleware.ClientAuth(apiKeysHandler.UpdateOriginsHandler, authService))
+		apiV1.POST("/apikeys/rotate", middleware.ClientAuth(apiKeysHandler.RotateHandler, authService))
+		apiV1.POST("/apikeys/expiration", middleware.ClientAuth(apiKeysHandler.ExpirationHandler, authService))
+		//secret scanners get a separate token if it is configured
+		leakReportToken := viper.GetString("api_keys.leak_report_token")
+		if leakReportToken == "" {
+			leakReportToken = serverToken
+		}
+		apiV1.POST("/apikeys/leaks", middleware.ServerAuth(apiKeysHandler.LeakReportHandler, leakReportToken))
+		apiV1.POST("/apikeys/revoke", middleware.ClientAuth(apiKeysHandler.RevokeHandler, authService))
+		apiV1.DELETE("/apikeys", middleware.ClientAuth(softDeletionHandler.DeleteApiKeyHandler, authService))
+		apiV1.POST("/apikeys/restore", middleware.ClientAuth(softDeletionHandler.RestoreApiKeyHandler, authService))
 
-		apiV1.GET("/apikeys", middleware.ServerAuth(middleware.IfModifiedSince(apiKeysHandler.GetHandler, storage.GetApiKeysLastUpdated), serverToken))
+		apiV1.GET("/apikeys", middleware.ServerAuth(middleware.IfModifiedSince(apiKeysHandler.GetHandler, apiKeysHandler.Cache().LastModified(storage.GetApiKeysLastUpdated)), serverToken))
 		apiV1.GET("/statistics", middleware.ClientAuth(statisticsHandler.GetHandler, authService))
 
-		configurationHandler, err := handlers.NewConfigurationHandler(storage, defaultS3)
+		configurationHandler, err := handlers.NewConfigurationHandler(storage, destinationsHistory, defaultS3)
 		if err != nil {
 			logging.Fatal("Failed to create configuration handler", err)
 		}
 		apiV1.GET("/eventnative/configuration", middleware.ClientAuth(configurationHandler.Handler, authService))
+		apiV1.POST("/eventnative/configuration/import", middleware.ClientAuth(configurationHandler.ImportHandler, authService))
 
 		apiV1.POST("/ssl", middleware.ClientAuth(handlers.NewCustomDomainHandler(sslUpdateExecutor).PerProjectHandler, authService))
 		apiV1.POST("/ssl/all", middleware.ServerAuth(handlers.NewCustomDomainHandler(sslUpdateExecutor).AllHandler, serverToken))
+		apiV1.DELETE("/domains", middleware.ClientAuth(softDeletionHandler.DeleteCustomDomainHandler, authService))
+		apiV1.POST("/domains/restore", middleware.ClientAuth(softDeletionHandler.RestoreCustomDomainHandler, authService))
 
-		destinationsHandler := handlers.NewDestinationsHandler(storage, defaultS3, statisticsPostgres, enService)
+		destinationsHealth := destinations.NewHealth(viper.GetBool("notifications.destinations_health"))
+		destinationsHandler := handlers.NewDestinationsHandler(storage, destinationsHistory, defaultS3, statisticsPostgres, enService, destinationsHealth)
 		destinationsRoute := apiV1.Group("/destinations")
-		destinationsRoute.GET("/", middleware.ServerAuth(middleware.IfModifiedSince(destinationsHandler.GetHandler, storage.GetDestinationsLastUpdated), serverToken))
+		destinationsRoute.GET("/", middleware.ServerAuth(middleware.IfModifiedSince(destinationsHandler.GetHandler, destinationsHandler.Cache().LastModified(storage.GetDestinationsLastUpdated)), serverToken))
+		destinationsRoute.POST("/", middleware.ClientAuth(destinationsHandler.CreateHandler, authService))
+		destinationsRoute.PUT("/", middleware.ClientAuth(destinationsHandler.UpdateHandler, authService))
+		destinationsRoute.GET("/status", middleware.ClientAuth(destinationsHandler.StatusHandler, authService))
+		destinationsRoute.GET("/types", middleware.ClientAuth(destinationsHandler.TypesHandler, authService))
+		destinationsRoute.POST("/preview", middleware.ClientAuth(destinationsHandler.PreviewHandler, authService))
+		destinationsRoute.POST("/dry_run", middleware.ClientAuth(destinationsHandler.DryRunHandler, authService))
 		destinationsRoute.POST("/test", middleware.ClientAuth(destinationsHandler.TestHandler, authService))
+		destinationsRoute.POST("/test/diagnostics", middleware.ClientAuth(destinationsHandler.DiagnoseHandler, authService))
+		destinationsRoute.GET("/test/diagnostics", middleware.ClientAuth(destinationsHandler.LastTestsHandler, authService))
+		destinationsRoute.DELETE("/", middleware.ClientAuth(softDeletionHandler.DeleteDestinationHandler, authService))
+		destinationsRoute.POST("/restore", middleware.ClientAuth(softDeletionHandler.RestoreDestinationHandler, authService))
+
+		destinationsHistoryHandler := handlers.NewDestinationsHistoryHandler(destinationsHistory)
+		destinationsRoute.GET("/history", middleware.ClientAuth(destinationsHistoryHandler.GetHandler, authService))
+		destinationsRoute.POST("/rollback", middleware.ClientAuth(destinationsHistoryHandler.RollbackHandler, authService))
+
+		apiV1.GET("/cache", middleware.ServerAuth(handlers.NewCacheHandler(destinationsHandler.Cache(), apiKeysHandler.Cache()).GetHandler, serverToken))
 
 		eventsHandler := handlers.NewEventsHandler(storage, enService)
 		apiV1.GET("/events", middleware.ClientAuth(eventsHandler.OldGetHandler, authService))
@@ -8,12 +8,15 @@ import (
 	"net/http"
 )
 
-const ProjectIdKey = "_project_id"
+const (
+	ProjectIdKey = "_project_id"
+	UserIdKey    = "_user_id"
+)
 
 func ClientAuth(main gin.HandlerFunc, service *authorization.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("X-Client-Auth")
-		projectId, err := service.Authenticate(c, token)
+		projectId, userId, err := service.Authenticate(c, token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, middleware.ErrorResponse{Error: err.Error(), Message: "You are not authorized"})
 			return
@@ -26,6 +29,7 @@ func ClientAuth(main gin.HandlerFunc, service *authorization.Service) gin.Handle
 		}
 
 		c.Set(ProjectIdKey, projectId)
+		c.Set(UserIdKey, userId)
 
 		main(c)
 	}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/jitsucom/enhosted/storages"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/spf13/viper"
+	"strings"
+)
+
+const migrateStorageCommand = "migrate-storage"
+
+//runStorageMigration copy all collections from one configured storage into another one
+//usage: enhosted -cfg=config.yaml migrate-storage -to=target_storage [-from=storage] [-dry-run]
+//where -from and -to are config keys with storage configuration in the same format as 'storage' section
+func runStorageMigration(args []string) {
+	command := flag.NewFlagSet(migrateStorageCommand, flag.ExitOnError)
+	from := command.String("from", "storage", "config key of the source storage")
+	to := command.String("to", "", "config key of the target storage")
+	dryRun := command.Bool("dry-run", false, "only report what would be migrated without writing into the target storage")
+	if err := command.Parse(args); err != nil {
+		logging.Fatal(err)
+	}
+	if *to == "" {
+		logging.Fatal("-to is a required parameter of " + migrateStorageCommand)
+	}
+	if *from == *to {
+		logging.Fatal("-from and -to must be different storages")
+	}
+
+	reports, err := migrateStorage(*from, *to, *dryRun)
+	if err != nil {
+		logging.Fatal(err)
+	}
+
+	if *dryRun {
+		logging.Infof("Dry run: storage [%s] -> [%s] wasn't modified", *from, *to)
+	} else {
+		logging.Infof("Storage [%s] has been migrated into [%s]", *from, *to)
+	}
+	for _, report := range reports {
+		logging.Info(report.String())
+		if len(report.New) > 0 {
+			logging.Infof("[%s] new: %s", report.Collection, strings.Join(report.New, ", "))
+		}
+		if len(report.Changed) > 0 {
+			logging.Infof("[%s] changed: %s", report.Collection, strings.Join(report.Changed, ", "))
+		}
+		if len(report.Skipped) > 0 {
+			logging.Warnf("[%s] skipped: %s", report.Collection, strings.Join(report.Skipped, ", "))
+		}
+	}
+}
+
+//migrateStorage create source and target storages and migrate collections. Storages are closed before return
+func migrateStorage(from, to string, dryRun bool) ([]*storages.CollectionReport, error) {
+	ctx := context.Background()
+	//default destination isn't required for migration: databases credentials are copied as is
+	source, err := storages.NewStorage(ctx, viper.Sub(from), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create source storage [%s]: %v", from, err)
+	}
+	defer source.Close()
+
+	target, err := storages.NewStorage(ctx, viper.Sub(to), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create target storage [%s]: %v", to, err)
+	}
+	defer target.Close()
+
+	reports, err := storages.Migrate(source, target, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to migrate storage [%s] -> [%s]: %v", from, to, err)
+	}
+	return reports, nil
+}
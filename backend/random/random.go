@@ -1,8 +1,8 @@
 package random
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"math/big"
 )
 
 const alphabeticalCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -10,13 +10,19 @@ const alphabeticalCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXY
 const charset = "abcdefghijklmnopqrstuvwxyz" +
 	"ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
-var seededRand *rand.Rand = rand.New(
-	rand.NewSource(time.Now().UnixNano()))
+const lowerCaseCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
 
+//StringWithCharset return a string of characters uniformly chosen from the charset with crypto/rand.
+//It panics if the system CSPRNG fails because nothing can be generated securely in that case
 func StringWithCharset(length int, charset string) string {
+	max := big.NewInt(int64(len(charset)))
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic("crypto/rand failed: " + err.Error())
+		}
+		b[i] = charset[n.Int64()]
 	}
 	return string(b)
 }
@@ -28,3 +34,7 @@ func String(length int) string {
 func AlphabeticalString(length int) string {
 	return StringWithCharset(length, alphabeticalCharset)
 }
+
+func LowerCaseString(length int) string {
+	return StringWithCharset(length, lowerCaseCharset)
+}
@@ -0,0 +1,45 @@
+package random
+
+import (
+	"hash/crc32"
+	"strings"
+)
+
+const (
+	secretEntropyLength  = 32
+	secretChecksumLength = 6
+)
+
+//Secret return a CSPRNG secret in self-identifying format: <prefix>.<scope>.<32 random base62 chars><6 base62 chars checksum>
+//The checksum is CRC32 of everything before it so secret scanners can detect leaked secrets without false positives:
+//(js|s2s)\.[A-Za-z0-9_.-]+\.[A-Za-z0-9]{38}
+func Secret(prefix, scope string) string {
+	body := prefix + "." + scope + "." + String(secretEntropyLength)
+	return body + checksum(body)
+}
+
+//ParseSecret return prefix and scope of the secret and true if the secret has the Secret format and a valid checksum.
+//The scope might contain dots (e.g. project ids) so the random part is taken from the end
+func ParseSecret(secret string) (string, string, bool) {
+	parts := strings.SplitN(secret, ".", 2)
+	randomLength := secretEntropyLength + secretChecksumLength
+	if len(parts) != 2 || parts[0] == "" || len(parts[1]) < randomLength+2 || parts[1][len(parts[1])-randomLength-1] != '.' {
+		return "", "", false
+	}
+	body := secret[:len(secret)-secretChecksumLength]
+	if checksum(body) != secret[len(body):] {
+		return "", "", false
+	}
+	return parts[0], parts[1][:len(parts[1])-randomLength-1], true
+}
+
+//checksum return CRC32 of the value as fixed length base62 string
+func checksum(value string) string {
+	sum := uint64(crc32.ChecksumIEEE([]byte(value)))
+	b := make([]byte, secretChecksumLength)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = charset[sum%uint64(len(charset))]
+		sum /= uint64(len(charset))
+	}
+	return string(b)
+}
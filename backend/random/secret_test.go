@@ -0,0 +1,59 @@
+package random
+
+import (
+	"regexp"
+	"testing"
+)
+
+var scannerPattern = regexp.MustCompile(`^(js|s2s)\.[A-Za-z0-9_.-]+\.[A-Za-z0-9]{38}$`)
+
+func TestSecretFormat(t *testing.T) {
+	secret := Secret("js", "project_1")
+	if !scannerPattern.MatchString(secret) {
+		t.Errorf("secret [%s] doesn't match secret scanners pattern", secret)
+	}
+	if other := Secret("js", "project_1"); other == secret {
+		t.Error("secrets must be random")
+	}
+}
+
+func TestParseSecret(t *testing.T) {
+	secret := Secret("s2s", "project")
+	prefix, scope, ok := ParseSecret(secret)
+	if !ok || prefix != "s2s" || scope != "project" {
+		t.Fatalf("ParseSecret(%s) = %s, %s, %v", secret, prefix, scope, ok)
+	}
+	dotted := Secret("js", "project.with.dots")
+	if prefix, scope, ok := ParseSecret(dotted); !ok || prefix != "js" || scope != "project.with.dots" {
+		t.Errorf("ParseSecret(%s) = %s, %s, %v", dotted, prefix, scope, ok)
+	}
+
+	//changed checksum character
+	last := secret[len(secret)-1]
+	replacement := byte('a')
+	if last == replacement {
+		replacement = 'b'
+	}
+	tampered := secret[:len(secret)-1] + string(replacement)
+
+	//changed random part keeps the checksum invalid
+	changedRandom := secret[:len(secret)-secretChecksumLength-1] + "x" + secret[len(secret)-secretChecksumLength:]
+	if changedRandom == secret {
+		changedRandom = secret[:len(secret)-secretChecksumLength-1] + "y" + secret[len(secret)-secretChecksumLength:]
+	}
+
+	for _, invalid := range []string{
+		tampered,
+		changedRandom,
+		"s2s.other" + secret[len("s2s.project"):],
+		secret[:len(secret)-1],
+		"s2s..abc",
+		"s2s.project",
+		"js.project.4f5e6a7b8c9d0e1f2a3b4c5d6e7f8a9b",
+		"",
+	} {
+		if _, _, ok := ParseSecret(invalid); ok {
+			t.Errorf("ParseSecret(%s) must fail", invalid)
+		}
+	}
+}
@@ -33,7 +33,7 @@ const rwPermission = 0666
 type CertificateService struct {
 	enHosts              []string
 	sshClient            *ssh.ClientWrapper
-	fbStorage            *storages.Firebase
+	storage              storages.Storage
 	serverConfigTemplate *template.Template
 	nginxConfigPath      string
 	acmeChallengePath    string
@@ -154,28 +154,28 @@ func (s *CertificateService) UploadCertificate(certificatePath string, privateKe
 	return nil
 }
 
-func NewCertificateService(sshClient *ssh.ClientWrapper, enHosts []string, firebase *storages.Firebase, serverConfigTemplatePath string, nginxSSLConfigPath string, acmeChallengePath string) (*CertificateService, error) {
+func NewCertificateService(sshClient *ssh.ClientWrapper, enHosts []string, storage storages.Storage, serverConfigTemplatePath string, nginxSSLConfigPath string, acmeChallengePath string) (*CertificateService, error) {
 	if enHosts == nil || len(enHosts) == 0 {
 		return nil, fmt.Errorf("failed to create custom domain processor: [enHosts] must not be empty")
 	}
-	if firebase == nil {
-		return nil, fmt.Errorf("failed to create custom domain processor: [firebase] must not be nil")
+	if storage == nil {
+		return nil, fmt.Errorf("failed to create custom domain processor: [storage] must not be nil")
 	}
 	serverConfigTemplate, err := template.ParseFiles(serverConfigTemplatePath)
 	if err != nil {
 		return nil, err
 	}
-	return &CertificateService{sshClient: sshClient, enHosts: enHosts, fbStorage: firebase, serverConfigTemplate: serverConfigTemplate, nginxConfigPath: files.FixPath(nginxSSLConfigPath), acmeChallengePath: files.FixPath(acmeChallengePath)}, nil
+	return &CertificateService{sshClient: sshClient, enHosts: enHosts, storage: storage, serverConfigTemplate: serverConfigTemplate, nginxConfigPath: files.FixPath(nginxSSLConfigPath), acmeChallengePath: files.FixPath(acmeChallengePath)}, nil
 }
 
 func (s *CertificateService) UpdateCustomDomains(projectId string, domains *entities.CustomDomains) error {
-	return s.fbStorage.UpdateCustomDomain(projectId, domains)
+	return s.storage.UpdateCustomDomain(projectId, domains)
 }
 
 func (s *CertificateService) LoadCustomDomains() (map[string]*entities.CustomDomains, error) {
-	return s.fbStorage.GetCustomDomains()
+	return s.storage.GetCustomDomains()
 }
 
 func (s *CertificateService) LoadCustomDomainsByProjectId(projectId string) (*entities.CustomDomains, error) {
-	return s.fbStorage.GetCustomDomainsByProjectId(projectId)
+	return s.storage.GetCustomDomainsByProjectId(projectId)
 }
@@ -146,6 +146,10 @@ func contains(domains []string, name string) bool {
 func filterExistingCNames(domains *entities.CustomDomains, enCName string) []string {
 	resultDomains := make([]string, 0)
 	for _, domain := range domains.Domains {
+		//certificates aren't issued for deleted domains
+		if domain.IsDeleted() {
+			continue
+		}
 
 		if checkDomain(domain.Name, enCName) {
 			resultDomains = append(resultDomains, domain.Name)
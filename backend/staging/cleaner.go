@@ -0,0 +1,123 @@
+package staging
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/storages"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/safego"
+	"time"
+)
+
+const cleanupPeriod = time.Hour
+
+//Cleaner deletes staged batch files from hosted S3 folders of destinations which use hosted staging.
+//EventNative deletes a staged file right after loading so only files of failed loads are left.
+//They are deleted when they are older than the retention
+type Cleaner struct {
+	ctx       context.Context
+	storage   storages.Storage
+	defaultS3 *enadapters.S3Config
+	retention time.Duration
+
+	s3Client *s3.S3
+
+	closed chan struct{}
+}
+
+//NewCleaner start cleanup job
+func NewCleaner(ctx context.Context, storage storages.Storage, defaultS3 *enadapters.S3Config, retention time.Duration) (*Cleaner, error) {
+	awsConfig := aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(defaultS3.AccessKeyID, defaultS3.SecretKey, "")).
+		WithRegion(defaultS3.Region)
+	if defaultS3.Endpoint != "" {
+		awsConfig.WithEndpoint(defaultS3.Endpoint)
+	}
+	s3Session, err := session.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating hosted S3 session: %v", err)
+	}
+
+	c := &Cleaner{ctx: ctx, storage: storage, defaultS3: defaultS3, retention: retention, s3Client: s3.New(s3Session, awsConfig), closed: make(chan struct{})}
+	c.start()
+	return c, nil
+}
+
+func (c *Cleaner) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func (c *Cleaner) start() {
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(cleanupPeriod)
+		defer ticker.Stop()
+		for {
+			c.clean()
+			select {
+			case <-c.closed:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+//clean delete expired staged files of all destinations with hosted staging. Deleted (but not purged) destinations are cleaned too
+func (c *Cleaner) clean() {
+	destinationsByProject, err := c.storage.GetDestinations()
+	if err != nil {
+		logging.Errorf("Error cleaning hosted staging: %v", err)
+		return
+	}
+
+	expiredBefore := time.Now().Add(-c.retention)
+	for projectId, destinationsEntity := range destinationsByProject {
+		for _, destination := range destinationsEntity.Destinations {
+			//the same destination id as in /destinations payload
+			config, err := destinations.MapConfig(projectId+"."+destination.Uid, destination, c.defaultS3)
+			if err != nil {
+				//broken destinations are reported in destinations status
+				continue
+			}
+
+			if folder := destinations.HostedStaging(config, c.defaultS3); folder != "" {
+				if err := c.cleanS3(folder, expiredBefore); err != nil {
+					logging.Errorf("Error cleaning hosted S3 staging of [%s] destination: %v", destination.Uid, err)
+				}
+			}
+		}
+	}
+}
+
+func (c *Cleaner) cleanS3(folder string, expiredBefore time.Time) error {
+	var keys []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(c.defaultS3.Bucket), Prefix: aws.String(folder + "/")}
+	err := c.s3Client.ListObjectsV2PagesWithContext(c.ctx, input, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range output.Contents {
+			if object.LastModified != nil && object.LastModified.Before(expiredBefore) {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if _, err := c.s3Client.DeleteObjectWithContext(c.ctx, &s3.DeleteObjectInput{Bucket: aws.String(c.defaultS3.Bucket), Key: aws.String(key)}); err != nil {
+			return fmt.Errorf("Error deleting [%s]: %v", key, err)
+		}
+	}
+	if len(keys) > 0 {
+		logging.Infof("Deleted %d expired staged files from hosted S3 folder [%s]", len(keys), folder)
+	}
+	return nil
+}
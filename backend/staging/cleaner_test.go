@@ -0,0 +1,118 @@
+package staging
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/storages"
+	enadapters "github.com/jitsucom/eventnative/adapters"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 serves ListObjectsV2 and DeleteObject requests of the path style S3 API
+type fakeS3 struct {
+	sync.Mutex
+	modified map[string]time.Time
+	prefixes []string
+	deleted  []string
+}
+
+func (fs *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.Lock()
+	defer fs.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/hosted-bucket/")
+	switch r.Method {
+	case http.MethodDelete:
+		fs.deleted = append(fs.deleted, key)
+		delete(fs.modified, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		prefix := r.URL.Query().Get("prefix")
+		fs.prefixes = append(fs.prefixes, prefix)
+		var contents strings.Builder
+		for name, modified := range fs.modified {
+			if strings.HasPrefix(name, prefix) {
+				fmt.Fprintf(&contents, "<Contents><Key>%s</Key><LastModified>%s</LastModified></Contents>", name, modified.UTC().Format(time.RFC3339))
+			}
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>hosted-bucket</Name><Prefix>%s</Prefix><IsTruncated>false</IsTruncated>%s</ListBucketResult>`, prefix, contents.String())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestCleanerDeletesExpiredStagedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cleaner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storage, err := storages.NewLocal(filepath.Join(dir, "db.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+
+	hosted := &entities.Destination{Uid: "hosted", Type: "redshift", Data: &entities.RedshiftFormData{Mode: "batch",
+		Host: "redshift.example.com", Db: "db", Username: "user", Password: "password", UseHostedS3: true}}
+	own := &entities.Destination{Uid: "own", Type: "redshift", Data: &entities.RedshiftFormData{Mode: "batch",
+		Host: "redshift.example.com", Db: "db", Username: "user", Password: "password",
+		S3AccessKey: "own-key", S3SecretKey: "own-secret", S3Bucket: "hosted-bucket", S3Region: "us-east-1"}}
+	if err := storage.UpdateDestinations("project", &entities.Destinations{Destinations: []*entities.Destination{hosted, own}}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	fs := &fakeS3{modified: map[string]time.Time{
+		"project.hosted/expired.log":   now.Add(-2 * time.Hour),
+		"project.hosted/recent.log":    now,
+		"project.hosted2/expired.log":  now.Add(-2 * time.Hour),
+		"project.own/expired.log":      now.Add(-2 * time.Hour),
+		"project.hosted-expired.log":   now.Add(-2 * time.Hour),
+		"expired.log":                  now.Add(-2 * time.Hour),
+		"project.hosted/nested/old.gz": now.Add(-3 * time.Hour),
+	}}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	defaultS3 := &enadapters.S3Config{AccessKeyID: "key", SecretKey: "secret", Bucket: "hosted-bucket", Region: "us-east-1", Endpoint: server.URL}
+	s3Session, err := session.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	awsConfig := aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(defaultS3.AccessKeyID, defaultS3.SecretKey, "")).
+		WithRegion(defaultS3.Region).
+		WithEndpoint(server.URL).
+		WithS3ForcePathStyle(true)
+	cleaner := &Cleaner{ctx: context.Background(), storage: storage, defaultS3: defaultS3, retention: time.Hour,
+		s3Client: s3.New(s3Session, awsConfig), closed: make(chan struct{})}
+
+	cleaner.clean()
+
+	//only the hosted staging destination folder is listed: the own bucket is left to the customer
+	if expected := []string{"project.hosted/"}; !reflect.DeepEqual(fs.prefixes, expected) {
+		t.Errorf("listed prefixes %v, expected %v", fs.prefixes, expected)
+	}
+	sort.Strings(fs.deleted)
+	if expected := []string{"project.hosted/expired.log", "project.hosted/nested/old.gz"}; !reflect.DeepEqual(fs.deleted, expected) {
+		t.Errorf("deleted %v, expected %v", fs.deleted, expected)
+	}
+}
@@ -0,0 +1,357 @@
+package storages
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/random"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/notifications"
+	"github.com/jitsucom/eventnative/safego"
+	"strings"
+	"time"
+)
+
+const expirationCheckPeriod = 10 * time.Minute
+
+var ErrApiKeyRevoked = errors.New("API key is revoked")
+
+//InvalidApiKeyError is returned when the requested API key change is invalid
+type InvalidApiKeyError struct {
+	Message string
+}
+
+func (iake *InvalidApiKeyError) Error() string {
+	return iake.Message
+}
+
+//ApiKeysManager creates and changes project API keys. Every change saves keys with a new _lastUpdated
+//so EventNative gets them on the next /api/v1/apikeys poll.
+//Rotated secrets are kept as previous ones during the grace period. The background job prunes expired previous secrets
+//and deletes expired keys
+type ApiKeysManager struct {
+	storage     Storage
+	gracePeriod time.Duration
+	notify      bool
+
+	closed chan struct{}
+}
+
+func NewApiKeysManager(storage Storage, gracePeriod time.Duration, notify bool) *ApiKeysManager {
+	akm := &ApiKeysManager{storage: storage, gracePeriod: gracePeriod, notify: notify, closed: make(chan struct{})}
+	akm.startPruning()
+	return akm
+}
+
+//List return all project API keys including deleted and revoked ones
+func (akm *ApiKeysManager) List(projectId string) ([]*entities.ApiKey, error) {
+	return akm.storage.GetApiKeysByProjectId(projectId)
+}
+
+//Create generate a new project API key with the label, origins and optional RFC3339 expiration time
+func (akm *ApiKeysManager) Create(projectId, label string, origins []string, expiresAt string) (*entities.ApiKey, error) {
+	if err := validateExpiration(expiresAt); err != nil {
+		return nil, err
+	}
+	unlock := apiKeysLocks.lock(projectId)
+	defer unlock()
+
+	keys, err := akm.storage.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := generateApiKey(projectId)
+	apiKey.Label = strings.TrimSpace(label)
+	apiKey.Origins = normalizeOrigins(origins)
+	apiKey.ExpiresAt = expiresAt
+	keys = append(keys, apiKey)
+	if err := akm.storage.UpdateApiKeys(projectId, &entities.ApiKeys{LastUpdated: time.Now().UTC().Format(LastUpdatedLayout), Keys: keys}); err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+//UpdateOrigins replace the API key origins. Empty origins allow all
+func (akm *ApiKeysManager) UpdateOrigins(projectId, id string, origins []string) (*entities.ApiKey, error) {
+	return akm.updateActive(projectId, id, func(apiKey *entities.ApiKey) {
+		apiKey.Origins = normalizeOrigins(origins)
+	})
+}
+
+//SetExpiration set the API key RFC3339 expiration time. Empty value removes expiration
+func (akm *ApiKeysManager) SetExpiration(projectId, id, expiresAt string) (*entities.ApiKey, error) {
+	if err := validateExpiration(expiresAt); err != nil {
+		return nil, err
+	}
+	return akm.updateActive(projectId, id, func(apiKey *entities.ApiKey) {
+		apiKey.ExpiresAt = expiresAt
+	})
+}
+
+//Rotate regenerate the API key client and server secrets. Id, label and origins are kept.
+//Old secrets stay valid during the grace period. If gracePeriod is nil the configured one is used, zero means old secrets are
+//invalidated at once
+func (akm *ApiKeysManager) Rotate(projectId, id string, gracePeriod *time.Duration) (*entities.ApiKey, error) {
+	grace := akm.gracePeriod
+	if gracePeriod != nil {
+		grace = *gracePeriod
+	}
+	if grace < 0 {
+		return nil, &InvalidApiKeyError{Message: "grace period must be non negative"}
+	}
+
+	return akm.updateActive(projectId, id, func(apiKey *entities.ApiKey) {
+		now := time.Now().UTC()
+		apiKey.PreviousSecrets = apiKey.ValidPreviousSecrets(now)
+		if grace > 0 {
+			apiKey.PreviousSecrets = append(apiKey.PreviousSecrets, &entities.PreviousSecrets{
+				ClientSecret: apiKey.ClientSecret,
+				ServerSecret: apiKey.ServerSecret,
+				ExpiresAt:    now.Add(grace).Format(time.RFC3339),
+			})
+		}
+		generateApiKeySecrets(projectId, apiKey)
+		apiKey.RotatedAt = now.Format(LastUpdatedLayout)
+	})
+}
+
+//Revoke delete the API key permanently: unlike soft deletion it can't be restored. Revoking of revoked key is a no-op
+func (akm *ApiKeysManager) Revoke(projectId, id string) error {
+	return updateApiKey(akm.storage, projectId, id, func(apiKey *entities.ApiKey) bool {
+		if apiKey.IsRevoked() {
+			return false
+		}
+		now := time.Now().UTC().Format(LastUpdatedLayout)
+		apiKey.RevokedAt = now
+		if !apiKey.IsDeleted() {
+			apiKey.DeletedAt = now
+		}
+		return true
+	})
+}
+
+//RevokeLeaked revoke the API key which current or previous secret is the leaked one and notify about it.
+//Return the key id or ErrNoFound if the secret isn't a project API key secret
+func (akm *ApiKeysManager) RevokeLeaked(secret, source string) (string, error) {
+	projectId, apiKey, err := akm.findBySecret(secret)
+	if err != nil {
+		return "", err
+	}
+	if apiKey.IsRevoked() {
+		return apiKey.Id, nil
+	}
+	if err := akm.Revoke(projectId, apiKey.Id); err != nil {
+		return "", err
+	}
+
+	warning := fmt.Sprintf("API key [%s] was revoked because its secret was reported as leaked (%s)", apiKey.Id, source)
+	logging.Warnf("Project [%s]: %s", projectId, warning)
+	if akm.notify {
+		notifications.SystemErrorf("Project [%s]: %s", projectId, warning)
+	}
+	return apiKey.Id, nil
+}
+
+func (akm *ApiKeysManager) Close() error {
+	close(akm.closed)
+	return nil
+}
+
+//updateActive apply change to the not deleted API key and return it. Return ErrApiKeyRevoked if the key is revoked
+//and ErrNoFound if there is no such key or it is deleted
+func (akm *ApiKeysManager) updateActive(projectId, id string, change func(apiKey *entities.ApiKey)) (*entities.ApiKey, error) {
+	var result *entities.ApiKey
+	var changeErr error
+	err := updateApiKey(akm.storage, projectId, id, func(apiKey *entities.ApiKey) bool {
+		if apiKey.IsRevoked() {
+			changeErr = ErrApiKeyRevoked
+			return false
+		}
+		if apiKey.IsDeleted() {
+			changeErr = ErrNoFound
+			return false
+		}
+		change(apiKey)
+		result = apiKey
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if changeErr != nil {
+		return nil, changeErr
+	}
+	return result, nil
+}
+
+func (akm *ApiKeysManager) startPruning() {
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(expirationCheckPeriod)
+		defer ticker.Stop()
+		for {
+			akm.prune()
+			select {
+			case <-akm.closed:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+//prune remove previous secrets which grace period has ended and put tombstones into expired keys
+func (akm *ApiKeysManager) prune() {
+	keysByProject, err := akm.storage.GetApiKeysGroupByProjectId()
+	if err != nil {
+		logging.Errorf("Error pruning expired API keys secrets: %v", err)
+		return
+	}
+
+	for projectId := range keysByProject {
+		akm.pruneProject(projectId)
+	}
+}
+
+//pruneProject re-read project keys under the project lock so concurrent changes aren't overwritten
+func (akm *ApiKeysManager) pruneProject(projectId string) {
+	unlock := apiKeysLocks.lock(projectId)
+	defer unlock()
+
+	keys, err := akm.storage.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		logging.Errorf("Error pruning expired API keys secrets of [%s] project: %v", projectId, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	var warnings []string
+	changed := false
+	for _, apiKey := range keys {
+		valid := apiKey.ValidPreviousSecrets(now)
+		if len(valid) != len(apiKey.PreviousSecrets) {
+			if !apiKey.IsDeleted() {
+				warnings = append(warnings, fmt.Sprintf("%d previous secrets of API key [%s] expired after rotation and aren't accepted anymore", len(apiKey.PreviousSecrets)-len(valid), apiKey.Id))
+			}
+			apiKey.PreviousSecrets = valid
+			changed = true
+		}
+		if !apiKey.IsDeleted() && apiKey.IsExpired(now) {
+			warnings = append(warnings, fmt.Sprintf("API key [%s] expired at %s and was deleted", apiKey.Id, apiKey.ExpiresAt))
+			apiKey.DeletedAt = now.Format(LastUpdatedLayout)
+			apiKey.PreviousSecrets = nil
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := akm.storage.UpdateApiKeys(projectId, &entities.ApiKeys{LastUpdated: now.Format(LastUpdatedLayout), Keys: keys}); err != nil {
+		logging.Errorf("Error pruning expired API keys secrets of [%s] project: %v", projectId, err)
+		return
+	}
+	for _, warning := range warnings {
+		logging.Warnf("Project [%s]: %s", projectId, warning)
+		if akm.notify {
+			notifications.SystemErrorf("Project [%s]: %s", projectId, warning)
+		}
+	}
+}
+
+//updateApiKey apply change to the API key and save keys with a new _lastUpdated if the change returns true.
+//Return ErrNoFound if there is no API key with the id
+func updateApiKey(storage Storage, projectId, id string, change func(apiKey *entities.ApiKey) bool) error {
+	unlock := apiKeysLocks.lock(projectId)
+	defer unlock()
+
+	keys, err := storage.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		return err
+	}
+
+	for _, apiKey := range keys {
+		if apiKey.Id != id {
+			continue
+		}
+		if !change(apiKey) {
+			return nil
+		}
+		return storage.UpdateApiKeys(projectId, &entities.ApiKeys{LastUpdated: time.Now().UTC().Format(LastUpdatedLayout), Keys: keys})
+	}
+	return ErrNoFound
+}
+
+//findBySecret return the project id and the API key which current or previous secret is the js/s2s secret or ErrNoFound.
+//Checksummed secrets contain the project id. Secrets generated before checksums were added (<prefix>.<project id>.<random>)
+//are looked up in all projects keys because project ids might contain dots
+func (akm *ApiKeysManager) findBySecret(secret string) (string, *entities.ApiKey, error) {
+	if prefix, projectId, ok := random.ParseSecret(secret); ok {
+		if prefix != clientSecretPrefix && prefix != serverSecretPrefix {
+			return "", nil, ErrNoFound
+		}
+		keys, err := akm.storage.GetApiKeysByProjectId(projectId)
+		if err != nil {
+			return "", nil, err
+		}
+		if apiKey := findApiKeyBySecret(keys, secret); apiKey != nil {
+			return projectId, apiKey, nil
+		}
+		return "", nil, ErrNoFound
+	}
+
+	if !strings.HasPrefix(secret, clientSecretPrefix+".") && !strings.HasPrefix(secret, serverSecretPrefix+".") {
+		return "", nil, ErrNoFound
+	}
+	keysByProject, err := akm.storage.GetApiKeysGroupByProjectId()
+	if err != nil {
+		return "", nil, err
+	}
+	for projectId, keys := range keysByProject {
+		if apiKey := findApiKeyBySecret(keys, secret); apiKey != nil {
+			return projectId, apiKey, nil
+		}
+	}
+	return "", nil, ErrNoFound
+}
+
+//findApiKeyBySecret return the key which current or previous secrets contain the secret or nil
+func findApiKeyBySecret(keys []*entities.ApiKey, secret string) *entities.ApiKey {
+	for _, apiKey := range keys {
+		if apiKey.ClientSecret == secret || apiKey.ServerSecret == secret {
+			return apiKey
+		}
+		for _, previous := range apiKey.PreviousSecrets {
+			if previous.ClientSecret == secret || previous.ServerSecret == secret {
+				return apiKey
+			}
+		}
+	}
+	return nil
+}
+
+//validateExpiration return error if expiration time isn't empty and isn't a future RFC3339 time
+func validateExpiration(expiresAt string) error {
+	if expiresAt == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return &InvalidApiKeyError{Message: fmt.Sprintf("expiresAt must be RFC3339 time: %v", err)}
+	}
+	if !t.After(time.Now()) {
+		return &InvalidApiKeyError{Message: "expiresAt must be in the future"}
+	}
+	return nil
+}
+
+//normalizeOrigins return trimmed non empty origins
+func normalizeOrigins(origins []string) []string {
+	result := []string{}
+	for _, origin := range origins {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			result = append(result, origin)
+		}
+	}
+	return result
+}
@@ -0,0 +1,266 @@
+package storages
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/random"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+//newTestApiKeysManager return manager on a temporary local storage without the pruning job
+func newTestApiKeysManager(t *testing.T, gracePeriod time.Duration) (*ApiKeysManager, func()) {
+	dir, err := ioutil.TempDir("", "apikeys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewLocal(filepath.Join(dir, "db.json"), nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &ApiKeysManager{storage: storage, gracePeriod: gracePeriod, closed: make(chan struct{})}, func() {
+		storage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestApiKeysRotation(t *testing.T) {
+	akm, cleanup := newTestApiKeysManager(t, time.Hour)
+	defer cleanup()
+
+	created, err := akm.Create("project", "site", []string{" example.com ", ""}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldClient, oldServer := created.ClientSecret, created.ServerSecret
+
+	rotated, err := akm.Rotate("project", created.Id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Id != created.Id || rotated.Label != "site" || len(rotated.Origins) != 1 || rotated.Origins[0] != "example.com" {
+		t.Errorf("id, label and origins must be kept: %+v", rotated)
+	}
+	if rotated.ClientSecret == oldClient || rotated.ServerSecret == oldServer || rotated.RotatedAt == "" {
+		t.Errorf("secrets must be regenerated: %+v", rotated)
+	}
+	if _, projectId, ok := random.ParseSecret(rotated.ClientSecret); !ok || projectId != "project" {
+		t.Errorf("new client secret must contain the project id: %s", rotated.ClientSecret)
+	}
+
+	//old secrets are valid during the configured grace period
+	now := time.Now().UTC()
+	valid := rotated.ValidPreviousSecrets(now)
+	if len(valid) != 1 || valid[0].ClientSecret != oldClient || valid[0].ServerSecret != oldServer {
+		t.Fatalf("old secrets must be kept as previous ones: %+v", rotated.PreviousSecrets)
+	}
+	if rotated.ValidPreviousSecrets(now.Add(time.Hour+time.Minute)) != nil {
+		t.Errorf("old secrets must expire after the grace period: %s", valid[0].ExpiresAt)
+	}
+	keys, err := akm.List("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findApiKeyBySecret(keys, oldServer) == nil {
+		t.Error("key must be found by the previous secret")
+	}
+
+	//zero grace period doesn't keep the replaced secrets but keeps still valid previous ones
+	noGrace := time.Duration(0)
+	second, err := akm.Rotate("project", created.Id, &noGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.PreviousSecrets) != 1 || second.PreviousSecrets[0].ClientSecret != oldClient {
+		t.Errorf("only the first rotation secrets must be kept: %+v", second.PreviousSecrets)
+	}
+
+	negative := -time.Hour
+	if _, err := akm.Rotate("project", created.Id, &negative); err == nil {
+		t.Error("negative grace period must be rejected")
+	} else if _, ok := err.(*InvalidApiKeyError); !ok {
+		t.Errorf("expected InvalidApiKeyError, got %v", err)
+	}
+}
+
+func TestApiKeysRevokedCantBeChanged(t *testing.T) {
+	akm, cleanup := newTestApiKeysManager(t, time.Hour)
+	defer cleanup()
+
+	created, err := akm.Create("project", "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := akm.Rotate("project", created.Id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//leaked previous secret revokes the key
+	id, err := akm.RevokeLeaked(created.ClientSecret, "test")
+	if err != nil || id != created.Id {
+		t.Fatalf("RevokeLeaked() = %s, %v", id, err)
+	}
+	if _, err := akm.Rotate("project", created.Id, nil); err != ErrApiKeyRevoked {
+		t.Errorf("expected ErrApiKeyRevoked, got %v", err)
+	}
+	if _, err := akm.RevokeLeaked(rotated.ServerSecret, "test"); err != nil {
+		t.Errorf("revoking of revoked key must be a no-op: %v", err)
+	}
+	if _, err := akm.RevokeLeaked("js.unknown.secret", "test"); err != ErrNoFound {
+		t.Errorf("expected ErrNoFound, got %v", err)
+	}
+}
+
+func TestApiKeysPrune(t *testing.T) {
+	akm, cleanup := newTestApiKeysManager(t, time.Hour)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute).Format(time.RFC3339)
+	future := now.Add(time.Hour).Format(time.RFC3339)
+	keys := &entities.ApiKeys{LastUpdated: now.Add(-time.Hour).Format(LastUpdatedLayout), Keys: []*entities.ApiKey{
+		{Id: "rotated", ClientSecret: "js.1", ServerSecret: "s2s.1", PreviousSecrets: []*entities.PreviousSecrets{
+			{ClientSecret: "js.expired", ServerSecret: "s2s.expired", ExpiresAt: past},
+			{ClientSecret: "js.valid", ServerSecret: "s2s.valid", ExpiresAt: future},
+		}},
+		{Id: "expired", ClientSecret: "js.2", ServerSecret: "s2s.2", ExpiresAt: past, PreviousSecrets: []*entities.PreviousSecrets{
+			{ClientSecret: "js.grace", ServerSecret: "s2s.grace", ExpiresAt: future},
+		}},
+		{Id: "active", ClientSecret: "js.3", ServerSecret: "s2s.3", ExpiresAt: future},
+	}}
+	if err := akm.storage.UpdateApiKeys("project", keys); err != nil {
+		t.Fatal(err)
+	}
+	lastUpdated, err := akm.storage.GetApiKeysLastUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	akm.prune()
+
+	pruned, err := akm.List("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byId := map[string]*entities.ApiKey{}
+	for _, apiKey := range pruned {
+		byId[apiKey.Id] = apiKey
+	}
+	if rotated := byId["rotated"]; rotated.IsDeleted() || len(rotated.PreviousSecrets) != 1 || rotated.PreviousSecrets[0].ClientSecret != "js.valid" {
+		t.Errorf("only expired previous secrets must be pruned: %+v", rotated)
+	}
+	if expired := byId["expired"]; !expired.IsDeleted() || expired.PreviousSecrets != nil {
+		t.Errorf("expired key must be deleted with previous secrets: %+v", expired)
+	}
+	if active := byId["active"]; active.IsDeleted() {
+		t.Errorf("active key must be kept: %+v", active)
+	}
+
+	//EventNative gets pruned keys on the next poll
+	prunedLastUpdated, err := akm.storage.GetApiKeysLastUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !prunedLastUpdated.After(*lastUpdated) {
+		t.Errorf("_lastUpdated must be changed: %v, was %v", prunedLastUpdated, lastUpdated)
+	}
+}
+
+//slowReadStorage delays API keys reading to widen the window between read and write of concurrent changes
+type slowReadStorage struct {
+	Storage
+}
+
+func (srs *slowReadStorage) GetApiKeysByProjectId(projectId string) ([]*entities.ApiKey, error) {
+	keys, err := srs.Storage.GetApiKeysByProjectId(projectId)
+	time.Sleep(time.Millisecond)
+	return keys, err
+}
+
+func TestApiKeysConcurrentChanges(t *testing.T) {
+	akm, cleanup := newTestApiKeysManager(t, time.Hour)
+	defer cleanup()
+	akm.storage = &slowReadStorage{Storage: akm.storage}
+
+	created, err := akm.Create("project", "first", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const count = 10
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := akm.Create("project", "concurrent", nil, ""); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := akm.Rotate("project", created.Id, nil); err != nil {
+				t.Error(err)
+			}
+			akm.prune()
+		}()
+	}
+	wg.Wait()
+
+	keys, err := akm.List("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != count+1 {
+		t.Fatalf("expected %d keys, got %d: changes are lost", count+1, len(keys))
+	}
+	for _, apiKey := range keys {
+		if apiKey.Id == created.Id && len(apiKey.PreviousSecrets) != count {
+			t.Errorf("expected %d previous secrets, got %d: rotations are lost", count, len(apiKey.PreviousSecrets))
+		}
+	}
+}
+
+func TestApiKeysRevokeLeakedBySecret(t *testing.T) {
+	akm, cleanup := newTestApiKeysManager(t, time.Hour)
+	defer cleanup()
+
+	//secrets generated before checksums were added, project ids might contain dots
+	keys := []*entities.ApiKey{
+		{Id: "legacy", ClientSecret: "js.project.with.dots.abcdef", ServerSecret: "s2s.project.with.dots.abcdef"},
+		{Id: "other", ClientSecret: "js.project.abcdef"},
+	}
+	if err := akm.storage.UpdateApiKeys("project.with.dots", &entities.ApiKeys{LastUpdated: "2021-01-02T00:00:00.000Z", Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	dotted, err := akm.Create("project.with.dots", "checksummed", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"s2s.project.with.dots.abcdef", dotted.ClientSecret} {
+		if _, err := akm.RevokeLeaked(secret, "test"); err != nil {
+			t.Errorf("RevokeLeaked(%s) = %v", secret, err)
+		}
+	}
+	revoked, err := akm.List("project.with.dots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, apiKey := range revoked {
+		if expected := apiKey.Id != "other"; apiKey.IsRevoked() != expected {
+			t.Errorf("API key [%s] revoked: %v, expected %v", apiKey.Id, apiKey.IsRevoked(), expected)
+		}
+	}
+
+	for _, secret := range []string{"js.project.with.dots.unknown", "pg.project.with.dots.abcdef", random.Secret("pg", "project.with.dots"), "abcdef"} {
+		if _, err := akm.RevokeLeaked(secret, "test"); err != ErrNoFound {
+			t.Errorf("RevokeLeaked(%s): expected ErrNoFound, got %v", secret, err)
+		}
+	}
+}
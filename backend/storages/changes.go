@@ -0,0 +1,183 @@
+package storages
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+//Change is a notification about modified collection document
+//ProjectId is empty if the whole collection might have been changed (e.g. after reconnect)
+type Change struct {
+	Collection string
+	ProjectId  string
+	Version    uint64
+}
+
+//Subscription receives collection changes. Changes are coalesced if the subscriber is slow:
+//a received Change means that collection version is at least Change.Version
+type Subscription struct {
+	Changes <-chan Change
+
+	collections map[string]bool
+	changes     chan Change
+	feed        *ChangeFeed
+}
+
+//Unsubscribe stops receiving changes and closes Changes channel
+func (s *Subscription) Unsubscribe() {
+	s.feed.unsubscribe(s)
+}
+
+type collectionState struct {
+	version     uint64
+	lastUpdated string
+	synced      bool
+}
+
+//ChangeFeed keeps in-memory version and _lastUpdated of every collection and broadcasts changes to subscribers.
+//It is filled by the storage implementation (firestore snapshot listeners, postgres LISTEN/NOTIFY, local file writes)
+type ChangeFeed struct {
+	sync.RWMutex
+
+	collections   map[string]*collectionState
+	subscriptions map[*Subscription]bool
+}
+
+func NewChangeFeed() *ChangeFeed {
+	return &ChangeFeed{
+		collections:   map[string]*collectionState{},
+		subscriptions: map[*Subscription]bool{},
+	}
+}
+
+//Subscribe return Subscription on changes of the collections
+func (cf *ChangeFeed) Subscribe(collections ...string) *Subscription {
+	changes := make(chan Change, 1)
+	subscription := &Subscription{Changes: changes, changes: changes, collections: map[string]bool{}, feed: cf}
+	for _, collection := range collections {
+		subscription.collections[collection] = true
+	}
+
+	cf.Lock()
+	cf.subscriptions[subscription] = true
+	cf.Unlock()
+
+	return subscription
+}
+
+//Version return in-memory version of the collection. It is increased on every change
+func (cf *ChangeFeed) Version(collection string) uint64 {
+	cf.RLock()
+	defer cf.RUnlock()
+
+	if state, ok := cf.collections[collection]; ok {
+		return state.version
+	}
+	return 0
+}
+
+//LastUpdated return in-memory max _lastUpdated of the collection and false if the feed isn't synced with the storage
+func (cf *ChangeFeed) LastUpdated(collection string) (*time.Time, bool) {
+	cf.RLock()
+	defer cf.RUnlock()
+
+	state, ok := cf.collections[collection]
+	if !ok || !state.synced || state.lastUpdated == "" {
+		return nil, false
+	}
+
+	t, err := time.Parse(LastUpdatedLayout, state.lastUpdated)
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+//reset set actual collection _lastUpdated after (re)connect and notify subscribers about possible changes
+func (cf *ChangeFeed) reset(collection, lastUpdated string) {
+	cf.Lock()
+	defer cf.Unlock()
+
+	state := cf.getOrCreateState(collection)
+	state.lastUpdated = lastUpdated
+	state.synced = true
+	state.version++
+	cf.broadcast(Change{Collection: collection, Version: state.version})
+}
+
+//desync mark collection as not synced (e.g. after disconnect) so callers fall back to the storage
+func (cf *ChangeFeed) desync(collection string) {
+	cf.Lock()
+	defer cf.Unlock()
+
+	cf.getOrCreateState(collection).synced = false
+}
+
+//notify increase collection version, keep max _lastUpdated and broadcast the change
+func (cf *ChangeFeed) notify(collection, projectId, lastUpdated string) {
+	cf.Lock()
+	defer cf.Unlock()
+
+	state := cf.getOrCreateState(collection)
+	//LastUpdatedLayout has fixed length so values might be compared as strings
+	if lastUpdated > state.lastUpdated {
+		state.lastUpdated = lastUpdated
+	}
+	state.version++
+	cf.broadcast(Change{Collection: collection, ProjectId: projectId, Version: state.version})
+}
+
+//broadcast must be called under the write lock so subscribers always get the latest change
+func (cf *ChangeFeed) broadcast(change Change) {
+	for subscription := range cf.subscriptions {
+		if !subscription.collections[change.Collection] {
+			continue
+		}
+
+		select {
+		case subscription.changes <- change:
+		default:
+			//subscriber hasn't read previous change yet: replace it with the latest one
+			select {
+			case <-subscription.changes:
+			default:
+			}
+			select {
+			case subscription.changes <- change:
+			default:
+			}
+		}
+	}
+}
+
+func (cf *ChangeFeed) unsubscribe(subscription *Subscription) {
+	cf.Lock()
+	defer cf.Unlock()
+
+	if cf.subscriptions[subscription] {
+		delete(cf.subscriptions, subscription)
+		close(subscription.changes)
+	}
+}
+
+//getOrCreateState must be called under the write lock
+func (cf *ChangeFeed) getOrCreateState(collection string) *collectionState {
+	state, ok := cf.collections[collection]
+	if !ok {
+		state = &collectionState{}
+		cf.collections[collection] = state
+	}
+	return state
+}
+
+//parseLastUpdated return _lastUpdated value of json document or empty string
+func parseLastUpdated(data []byte) string {
+	doc := &struct {
+		LastUpdated string `json:"_lastUpdated"`
+	}{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return ""
+	}
+	return doc.LastUpdated
+}
@@ -0,0 +1,78 @@
+package storages
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"testing"
+	"time"
+)
+
+func receiveChange(t *testing.T, subscription *Subscription) Change {
+	select {
+	case change := <-subscription.Changes:
+		return change
+	case <-time.After(time.Second):
+		t.Fatal("change wasn't received")
+	}
+	return Change{}
+}
+
+func TestChangeFeedCoalescesChanges(t *testing.T) {
+	feed := NewChangeFeed()
+	subscription := feed.Subscribe(DestinationsCollection)
+	defer subscription.Unsubscribe()
+
+	feed.reset(DestinationsCollection, "2021-01-01T00:00:00.000Z")
+	feed.notify(ApiKeysCollection, "project", "2021-01-03T00:00:00.000Z")
+	feed.notify(DestinationsCollection, "project", "2021-01-02T00:00:00.000Z")
+
+	//slow subscriber gets only the latest change of subscribed collections
+	change := receiveChange(t, subscription)
+	if change.Collection != DestinationsCollection || change.ProjectId != "project" || change.Version != 2 {
+		t.Errorf("unexpected change: %+v", change)
+	}
+	select {
+	case change := <-subscription.Changes:
+		t.Errorf("unexpected change: %+v", change)
+	default:
+	}
+
+	lastUpdated, ok := feed.LastUpdated(DestinationsCollection)
+	if !ok || lastUpdated.Format(LastUpdatedLayout) != "2021-01-02T00:00:00.000Z" {
+		t.Errorf("unexpected _lastUpdated: %v %v", lastUpdated, ok)
+	}
+	//_lastUpdated isn't decreased
+	feed.notify(DestinationsCollection, "project", "2020-01-01T00:00:00.000Z")
+	if lastUpdated, ok := feed.LastUpdated(DestinationsCollection); !ok || lastUpdated.Format(LastUpdatedLayout) != "2021-01-02T00:00:00.000Z" {
+		t.Errorf("_lastUpdated is decreased: %v", lastUpdated)
+	}
+
+	feed.desync(DestinationsCollection)
+	if _, ok := feed.LastUpdated(DestinationsCollection); ok {
+		t.Error("not synced feed must not return _lastUpdated")
+	}
+}
+
+func TestLocalStorageNotifiesChanges(t *testing.T) {
+	storage, _, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+	subscription := storage.Changes().Subscribe(DestinationsCollection)
+	defer subscription.Unsubscribe()
+
+	version := storage.Changes().Version(DestinationsCollection)
+	lastUpdated := "2021-01-02T00:00:00.000Z"
+	if err := storage.UpdateDestinations("project", &entities.Destinations{LastUpdated: lastUpdated}); err != nil {
+		t.Fatal(err)
+	}
+
+	change := receiveChange(t, subscription)
+	if change.ProjectId != "project" || change.Version != version+1 {
+		t.Errorf("unexpected change: %+v", change)
+	}
+	fromFeed, err := storage.GetDestinationsLastUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromFeed == nil || fromFeed.Format(LastUpdatedLayout) != lastUpdated {
+		t.Errorf("expected _lastUpdated %s, got %v", lastUpdated, fromFeed)
+	}
+}
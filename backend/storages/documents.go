@@ -0,0 +1,385 @@
+package storages
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"io"
+	"sort"
+	"time"
+)
+
+//documentsDriver persists raw json documents grouped by collections (like firestore collections)
+type documentsDriver interface {
+	io.Closer
+	//get return nil if document doesn't exist
+	get(collection, id string) ([]byte, error)
+	//getAll return map with id:document
+	getAll(collection string) (map[string][]byte, error)
+	//create insert document only if it doesn't exist and return true if it was inserted
+	create(collection, id string, data []byte) (bool, error)
+	set(collection, id string, data []byte) error
+	//delete remove document if it exists
+	delete(collection, id string) error
+	//lastUpdated return max _lastUpdated value of collection documents or empty string
+	lastUpdated(collection string) (string, error)
+}
+
+//documentsStorage is a Storage implementation on top of documentsDriver
+//driver is responsible for filling changes feed
+type documentsStorage struct {
+	name               string
+	driver             documentsDriver
+	changes            *ChangeFeed
+	defaultDestination *destinations.Postgres
+}
+
+func (ds *documentsStorage) Changes() *ChangeFeed {
+	return ds.changes
+}
+
+func (ds *documentsStorage) CreateDatabase(projectId string) (*entities.Database, error) {
+	database := &entities.Database{}
+	found, err := ds.getDocument(defaultDatabaseCredentialsCollection, projectId, database)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting database entity for [%s] project: %v", projectId, err)
+	}
+	if found {
+		return database, nil
+	}
+
+	//create new
+	database, err = ds.defaultDestination.CreateDatabase(projectId)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating postgres default destination for projectId: [%s]: %v", projectId, err)
+	}
+
+	created, err := ds.createDocument(defaultDatabaseCredentialsCollection, projectId, database)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, fmt.Errorf("Database entity for [%s] project has been already created", projectId)
+	}
+	return database, nil
+}
+
+//GetDatabases return map with projectId:default database credentials
+func (ds *documentsStorage) GetDatabases() (map[string]*entities.Database, error) {
+	docs, err := ds.driver.getAll(defaultDatabaseCredentialsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get databases from %s: %v", ds.name, err)
+	}
+
+	result := map[string]*entities.Database{}
+	for projectId, data := range docs {
+		database := &entities.Database{}
+		if err := json.Unmarshal(data, database); err != nil {
+			return nil, fmt.Errorf("failed to parse database for project [%s]: %v", projectId, err)
+		}
+		result[projectId] = database
+	}
+	return result, nil
+}
+
+func (ds *documentsStorage) UpdateDatabase(projectId string, database *entities.Database) error {
+	return ds.setDocument(defaultDatabaseCredentialsCollection, projectId, database)
+}
+
+func (ds *documentsStorage) GetDestinationsLastUpdated() (*time.Time, error) {
+	return ds.getLastUpdated(DestinationsCollection)
+}
+
+//GetDestinations() return map with projectId:destinations
+func (ds *documentsStorage) GetDestinations() (map[string]*entities.Destinations, error) {
+	docs, err := ds.driver.getAll(DestinationsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get destinations from %s: %v", ds.name, err)
+	}
+
+	result := map[string]*entities.Destinations{}
+	for projectId, data := range docs {
+		destinationsEntity := &entities.Destinations{}
+		if err := json.Unmarshal(data, destinationsEntity); err != nil {
+			return nil, fmt.Errorf("failed to parse destinations for project [%s]: %v", projectId, err)
+		}
+		result[projectId] = destinationsEntity
+	}
+	return result, nil
+}
+
+func (ds *documentsStorage) GetDestinationsByProjectId(projectId string) ([]*entities.Destination, error) {
+	dest := &entities.Destinations{}
+	found, err := ds.getDocument(DestinationsCollection, projectId, dest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting destinations by projectId [%s]: %v", projectId, err)
+	}
+	if !found {
+		return make([]*entities.Destination, 0), nil
+	}
+	return dest.Destinations, nil
+}
+
+func (ds *documentsStorage) UpdateDestinations(projectId string, destinations *entities.Destinations) error {
+	encrypted, err := encryptedDestinations(destinations)
+	if err != nil {
+		return err
+	}
+	return ds.setDocument(DestinationsCollection, projectId, encrypted)
+}
+
+func (ds *documentsStorage) GetDestinationsRevisions(projectId string, limit int) ([]*entities.DestinationsRevision, error) {
+	docs, err := ds.driver.getAll(revisionsCollectionOf(projectId))
+	if err != nil {
+		return nil, fmt.Errorf("error getting destinations revisions by projectId [%s]: %v", projectId, err)
+	}
+
+	result := make([]*entities.DestinationsRevision, 0, len(docs))
+	for revisionId, data := range docs {
+		revision := &entities.DestinationsRevision{}
+		if err := json.Unmarshal(data, revision); err != nil {
+			return nil, fmt.Errorf("error parsing destinations revision [%s] of projectId [%s]: %v", revisionId, projectId, err)
+		}
+		result = append(result, revision)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id > result[j].Id
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (ds *documentsStorage) GetDestinationsRevision(projectId, revisionId string) (*entities.DestinationsRevision, error) {
+	revision := &entities.DestinationsRevision{}
+	found, err := ds.getDocument(revisionsCollectionOf(projectId), revisionId, revision)
+	if err != nil {
+		return nil, fmt.Errorf("error getting destinations revision [%s] of projectId [%s]: %v", revisionId, projectId, err)
+	}
+	if !found {
+		return nil, ErrNoFound
+	}
+	return revision, nil
+}
+
+func (ds *documentsStorage) AddDestinationsRevision(projectId string, revision *entities.DestinationsRevision) error {
+	encrypted, err := encryptedRevision(revision)
+	if err != nil {
+		return err
+	}
+	created, err := ds.createDocument(revisionsCollectionOf(projectId), revision.Id, encrypted)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("Destinations revision [%s] of projectId [%s] already exists", revision.Id, projectId)
+	}
+	return nil
+}
+
+func (ds *documentsStorage) DeleteDestinationsRevision(projectId, revisionId string) error {
+	return ds.driver.delete(revisionsCollectionOf(projectId), revisionId)
+}
+
+func (ds *documentsStorage) GetConnectionTests(projectId string) ([]*entities.ConnectionTest, error) {
+	docs, err := ds.driver.getAll(connectionTestsCollectionOf(projectId))
+	if err != nil {
+		return nil, fmt.Errorf("error getting connection tests by projectId [%s]: %v", projectId, err)
+	}
+
+	result := make([]*entities.ConnectionTest, 0, len(docs))
+	for uid, data := range docs {
+		test := &entities.ConnectionTest{}
+		if err := json.Unmarshal(data, test); err != nil {
+			return nil, fmt.Errorf("error parsing connection test of destination [%s] of projectId [%s]: %v", uid, projectId, err)
+		}
+		result = append(result, test)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DestinationUid < result[j].DestinationUid
+	})
+	return result, nil
+}
+
+func (ds *documentsStorage) SaveConnectionTest(projectId string, test *entities.ConnectionTest) error {
+	return ds.setDocument(connectionTestsCollectionOf(projectId), test.DestinationUid, test)
+}
+
+func (ds *documentsStorage) GetApiKeysLastUpdated() (*time.Time, error) {
+	return ds.getLastUpdated(ApiKeysCollection)
+}
+
+func (ds *documentsStorage) GetApiKeys() ([]*entities.ApiKey, error) {
+	var result []*entities.ApiKey
+	keys, err := ds.GetApiKeysGroupByProjectId()
+	if err != nil {
+		return nil, err
+	}
+	for _, apiKeys := range keys {
+		result = append(result, apiKeys...)
+	}
+	return result, nil
+}
+
+func (ds *documentsStorage) GetApiKeysGroupByProjectId() (map[string][]*entities.ApiKey, error) {
+	docs, err := ds.driver.getAll(ApiKeysCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys from %s: %v", ds.name, err)
+	}
+
+	result := make(map[string][]*entities.ApiKey)
+	for projectId, data := range docs {
+		apiKeys := &entities.ApiKeys{}
+		if err := json.Unmarshal(data, apiKeys); err != nil {
+			return nil, fmt.Errorf("failed to parse API keys for project [%s]: %v", projectId, err)
+		}
+		result[projectId] = apiKeys.Keys
+	}
+	return result, nil
+}
+
+func (ds *documentsStorage) GetApiKeysByProjectId(projectId string) ([]*entities.ApiKey, error) {
+	apiKeys := &entities.ApiKeys{}
+	found, err := ds.getDocument(ApiKeysCollection, projectId, apiKeys)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting api keys by projectId [%s]: %v", projectId, err)
+	}
+	if !found {
+		return make([]*entities.ApiKey, 0), nil
+	}
+	return apiKeys.Keys, nil
+}
+
+func (ds *documentsStorage) UpdateApiKeys(projectId string, apiKeys *entities.ApiKeys) error {
+	return ds.setDocument(ApiKeysCollection, projectId, apiKeys)
+}
+
+// Generates default key per project only in case if no other API key exists
+func (ds *documentsStorage) CreateDefaultApiKey(projectId string) error {
+	keys, err := ds.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return nil
+	}
+	_, err = ds.createDocument(ApiKeysCollection, projectId, generateDefaultAPIToken(projectId))
+	return err
+}
+
+func (ds *documentsStorage) GetCustomDomains() (map[string]*entities.CustomDomains, error) {
+	docs, err := ds.driver.getAll(customDomainsCollection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get custom domains from %s: %v", ds.name, err)
+	}
+
+	var result = map[string]*entities.CustomDomains{}
+	for projectId, data := range docs {
+		customDomains := &entities.CustomDomains{}
+		if err := json.Unmarshal(data, customDomains); err != nil {
+			return nil, fmt.Errorf("failed to parse custom domains for project [%s]: %v", projectId, err)
+		}
+		result[projectId] = customDomains
+	}
+	return result, nil
+}
+
+func (ds *documentsStorage) GetCustomDomainsByProjectId(projectId string) (*entities.CustomDomains, error) {
+	customDomains := &entities.CustomDomains{}
+	found, err := ds.getDocument(customDomainsCollection, projectId, customDomains)
+	if err != nil {
+		return nil, fmt.Errorf("error getting custom domains of projectId [%s]: %v", projectId, err)
+	}
+	if !found {
+		return nil, ErrNoFound
+	}
+	return customDomains, nil
+}
+
+func (ds *documentsStorage) UpdateCustomDomain(projectId string, customDomains *entities.CustomDomains) error {
+	return ds.setDocument(customDomainsCollection, projectId, customDomains)
+}
+
+func (ds *documentsStorage) Close() (multiErr error) {
+	if ds.defaultDestination != nil {
+		if err := ds.defaultDestination.Close(); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
+	}
+
+	if err := ds.driver.Close(); err != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("Error closing %s storage: %v", ds.name, err))
+	}
+
+	return
+}
+
+//getDocument unmarshal document into value and return false if document doesn't exist
+func (ds *documentsStorage) getDocument(collection, id string, value interface{}) (bool, error) {
+	data, err := ds.driver.get(collection, id)
+	if err != nil {
+		return false, err
+	}
+	if data == nil {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("error parsing [%s] document of [%s] collection: %v", id, collection, err)
+	}
+	return true, nil
+}
+
+func (ds *documentsStorage) createDocument(collection, id string, value interface{}) (bool, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("error serializing [%s] document of [%s] collection: %v", id, collection, err)
+	}
+
+	return ds.driver.create(collection, id, b)
+}
+
+func (ds *documentsStorage) setDocument(collection, id string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error serializing [%s] document of [%s] collection: %v", id, collection, err)
+	}
+
+	return ds.driver.set(collection, id, b)
+}
+
+func (ds *documentsStorage) getLastUpdated(collection string) (*time.Time, error) {
+	if lastUpdated, ok := ds.changes.LastUpdated(collection); ok {
+		return lastUpdated, nil
+	}
+
+	lastUpdated, err := ds.driver.lastUpdated(collection)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting %s %s: %v", collection, lastUpdatedField, err)
+	}
+	if lastUpdated == "" {
+		return nil, fmt.Errorf("Empty %s %s", collection, lastUpdatedField)
+	}
+
+	t, err := time.Parse(LastUpdatedLayout, lastUpdated)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing [%s] field into [%s] layout: %v", lastUpdatedField, LastUpdatedLayout, err)
+	}
+
+	return &t, nil
+}
+
+//revisionsCollectionOf return collection name of project destinations revisions (like firestore subcollection)
+func revisionsCollectionOf(projectId string) string {
+	return destinationsHistoryCollection + "/" + projectId + "/" + revisionsCollection
+}
+
+//connectionTestsCollectionOf return collection name of project destinations connection tests (like firestore subcollection)
+func connectionTestsCollectionOf(projectId string) string {
+	return connectionTestsCollection + "/" + projectId + "/" + destinationsSubcollection
+}
@@ -9,8 +9,8 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/jitsucom/enhosted/destinations"
 	"github.com/jitsucom/enhosted/entities"
-	"github.com/jitsucom/enhosted/random"
-	_ "github.com/lib/pq"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/safego"
 	"github.com/spf13/viper"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
@@ -19,22 +19,13 @@ import (
 	"time"
 )
 
-const (
-	defaultDatabaseCredentialsCollection = "default_database_credentials"
-	destinationsCollection               = "destinations"
-	apiKeysCollection                    = "api_keys"
-	customDomainsCollection              = "custom_domains"
-	lastUpdatedField                     = "_lastUpdated"
-
-	LastUpdatedLayout = "2006-01-02T15:04:05.000Z"
-)
-
-var ErrNoFound = errors.New("Collection wasn't found")
-
 type Firebase struct {
 	ctx                context.Context
 	client             *firestore.Client
 	defaultDestination *destinations.Postgres
+
+	changes     *ChangeFeed
+	cancelWatch context.CancelFunc
 }
 
 func NewFirebase(ctx context.Context, firebaseViper *viper.Viper, defaultDestination *destinations.Postgres) (*Firebase, error) {
@@ -49,7 +40,62 @@ func NewFirebase(ctx context.Context, firebaseViper *viper.Viper, defaultDestina
 		return nil, err
 	}
 
-	return &Firebase{ctx: ctx, client: firestoreClient, defaultDestination: defaultDestination}, nil
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	fb := &Firebase{ctx: ctx, client: firestoreClient, defaultDestination: defaultDestination, changes: NewChangeFeed(), cancelWatch: cancelWatch}
+	for _, collection := range watchedCollections {
+		fb.watch(watchCtx, collection)
+	}
+
+	return fb, nil
+}
+
+//watch start firestore snapshot listener which fills the change feed
+func (fb *Firebase) watch(ctx context.Context, collection string) {
+	safego.RunWithRestart(func() {
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			iter := fb.client.Collection(collection).Snapshots(ctx)
+			initial := true
+			for {
+				snapshot, err := iter.Next()
+				if err != nil {
+					iter.Stop()
+					fb.changes.desync(collection)
+					if ctx.Err() == nil {
+						logging.Errorf("Error listening to firestore [%s] collection changes: %v", collection, err)
+						//delay after error
+						time.Sleep(10 * time.Second)
+					}
+					break
+				}
+
+				//the first snapshot contains all documents
+				if initial {
+					initial = false
+					lastUpdated := ""
+					for _, change := range snapshot.Changes {
+						if documentLastUpdated := firestoreLastUpdated(change.Doc); documentLastUpdated > lastUpdated {
+							lastUpdated = documentLastUpdated
+						}
+					}
+					fb.changes.reset(collection, lastUpdated)
+					continue
+				}
+
+				for _, change := range snapshot.Changes {
+					fb.changes.notify(collection, change.Doc.Ref.ID, firestoreLastUpdated(change.Doc))
+				}
+			}
+		}
+	})
+}
+
+//Changes return the change feed which is filled by firestore snapshot listeners
+func (fb *Firebase) Changes() *ChangeFeed {
+	return fb.changes
 }
 
 func (fb *Firebase) CreateDatabase(projectId string) (*entities.Database, error) {
@@ -80,8 +126,39 @@ func (fb *Firebase) CreateDatabase(projectId string) (*entities.Database, error)
 	return database, err
 }
 
+//GetDatabases return map with projectId:default database credentials
+func (fb *Firebase) GetDatabases() (map[string]*entities.Database, error) {
+	result := map[string]*entities.Database{}
+	iter := fb.client.Collection(defaultDatabaseCredentialsCollection).Documents(fb.ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get databases from firestore: %v", err)
+		}
+		database := &entities.Database{}
+		err = doc.DataTo(database)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse database for project [%s]: %v", doc.Ref.ID, err)
+		}
+		result[doc.Ref.ID] = database
+	}
+	return result, nil
+}
+
+func (fb *Firebase) UpdateDatabase(projectId string, database *entities.Database) error {
+	_, err := fb.client.Collection(defaultDatabaseCredentialsCollection).Doc(projectId).Set(fb.ctx, database)
+	return err
+}
+
 func (fb *Firebase) GetDestinationsLastUpdated() (*time.Time, error) {
-	result := fb.client.Collection(destinationsCollection).Select(lastUpdatedField).OrderBy(lastUpdatedField, firestore.Desc).Limit(1).Documents(fb.ctx)
+	if lastUpdated, ok := fb.changes.LastUpdated(DestinationsCollection); ok {
+		return lastUpdated, nil
+	}
+
+	result := fb.client.Collection(DestinationsCollection).Select(lastUpdatedField).OrderBy(lastUpdatedField, firestore.Desc).Limit(1).Documents(fb.ctx)
 
 	docs, err := result.GetAll()
 	if err != nil {
@@ -109,7 +186,7 @@ func (fb *Firebase) GetDestinationsLastUpdated() (*time.Time, error) {
 //GetDestinations() return map with projectId:destinations
 func (fb *Firebase) GetDestinations() (map[string]*entities.Destinations, error) {
 	result := map[string]*entities.Destinations{}
-	iter := fb.client.Collection(destinationsCollection).Documents(fb.ctx)
+	iter := fb.client.Collection(DestinationsCollection).Documents(fb.ctx)
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -129,7 +206,7 @@ func (fb *Firebase) GetDestinations() (map[string]*entities.Destinations, error)
 }
 
 func (fb *Firebase) GetDestinationsByProjectId(projectId string) ([]*entities.Destination, error) {
-	doc, err := fb.client.Collection(destinationsCollection).Doc(projectId).Get(fb.ctx)
+	doc, err := fb.client.Collection(DestinationsCollection).Doc(projectId).Get(fb.ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return make([]*entities.Destination, 0), nil
@@ -146,8 +223,104 @@ func (fb *Firebase) GetDestinationsByProjectId(projectId string) ([]*entities.De
 	return dest.Destinations, nil
 }
 
+func (fb *Firebase) UpdateDestinations(projectId string, destinations *entities.Destinations) error {
+	encrypted, err := encryptedDestinations(destinations)
+	if err != nil {
+		return err
+	}
+	_, err = fb.client.Collection(DestinationsCollection).Doc(projectId).Set(fb.ctx, encrypted)
+	return err
+}
+
+func (fb *Firebase) GetDestinationsRevisions(projectId string, limit int) ([]*entities.DestinationsRevision, error) {
+	query := fb.revisions(projectId).OrderBy("_id", firestore.Desc)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	docs, err := query.Documents(fb.ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting destinations revisions by projectId [%s]: %v", projectId, err)
+	}
+
+	result := make([]*entities.DestinationsRevision, 0, len(docs))
+	for _, doc := range docs {
+		revision := &entities.DestinationsRevision{}
+		if err := doc.DataTo(revision); err != nil {
+			return nil, fmt.Errorf("error parsing destinations revision [%s] of projectId [%s]: %v", doc.Ref.ID, projectId, err)
+		}
+		result = append(result, revision)
+	}
+	return result, nil
+}
+
+func (fb *Firebase) GetDestinationsRevision(projectId, revisionId string) (*entities.DestinationsRevision, error) {
+	doc, err := fb.revisions(projectId).Doc(revisionId).Get(fb.ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrNoFound
+		}
+		return nil, fmt.Errorf("error getting destinations revision [%s] of projectId [%s]: %v", revisionId, projectId, err)
+	}
+
+	revision := &entities.DestinationsRevision{}
+	if err := doc.DataTo(revision); err != nil {
+		return nil, fmt.Errorf("error parsing destinations revision [%s] of projectId [%s]: %v", revisionId, projectId, err)
+	}
+	return revision, nil
+}
+
+func (fb *Firebase) AddDestinationsRevision(projectId string, revision *entities.DestinationsRevision) error {
+	encrypted, err := encryptedRevision(revision)
+	if err != nil {
+		return err
+	}
+	_, err = fb.revisions(projectId).Doc(revision.Id).Create(fb.ctx, encrypted)
+	return err
+}
+
+func (fb *Firebase) DeleteDestinationsRevision(projectId, revisionId string) error {
+	_, err := fb.revisions(projectId).Doc(revisionId).Delete(fb.ctx)
+	return err
+}
+
+//revisions return destinations revisions subcollection of the project
+func (fb *Firebase) revisions(projectId string) *firestore.CollectionRef {
+	return fb.client.Collection(destinationsHistoryCollection).Doc(projectId).Collection(revisionsCollection)
+}
+
+func (fb *Firebase) GetConnectionTests(projectId string) ([]*entities.ConnectionTest, error) {
+	docs, err := fb.connectionTests(projectId).OrderBy("destinationUid", firestore.Asc).Documents(fb.ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting connection tests by projectId [%s]: %v", projectId, err)
+	}
+
+	result := make([]*entities.ConnectionTest, 0, len(docs))
+	for _, doc := range docs {
+		test := &entities.ConnectionTest{}
+		if err := doc.DataTo(test); err != nil {
+			return nil, fmt.Errorf("error parsing connection test of destination [%s] of projectId [%s]: %v", doc.Ref.ID, projectId, err)
+		}
+		result = append(result, test)
+	}
+	return result, nil
+}
+
+func (fb *Firebase) SaveConnectionTest(projectId string, test *entities.ConnectionTest) error {
+	_, err := fb.connectionTests(projectId).Doc(test.DestinationUid).Set(fb.ctx, test)
+	return err
+}
+
+//connectionTests return destinations connection tests subcollection of the project
+func (fb *Firebase) connectionTests(projectId string) *firestore.CollectionRef {
+	return fb.client.Collection(connectionTestsCollection).Doc(projectId).Collection(destinationsSubcollection)
+}
+
 func (fb *Firebase) GetApiKeysLastUpdated() (*time.Time, error) {
-	result := fb.client.Collection(apiKeysCollection).Select(lastUpdatedField).OrderBy(lastUpdatedField, firestore.Desc).Limit(1).Documents(fb.ctx)
+	if lastUpdated, ok := fb.changes.LastUpdated(ApiKeysCollection); ok {
+		return lastUpdated, nil
+	}
+
+	result := fb.client.Collection(ApiKeysCollection).Select(lastUpdatedField).OrderBy(lastUpdatedField, firestore.Desc).Limit(1).Documents(fb.ctx)
 
 	docs, err := result.GetAll()
 	if err != nil {
@@ -186,7 +359,7 @@ func (fb *Firebase) GetApiKeys() ([]*entities.ApiKey, error) {
 
 func (fb *Firebase) GetApiKeysGroupByProjectId() (map[string][]*entities.ApiKey, error) {
 	result := make(map[string][]*entities.ApiKey)
-	iter := fb.client.Collection(apiKeysCollection).Documents(fb.ctx)
+	iter := fb.client.Collection(ApiKeysCollection).Documents(fb.ctx)
 	for {
 		doc, err := iter.Next()
 		if err == iterator.Done {
@@ -206,7 +379,7 @@ func (fb *Firebase) GetApiKeysGroupByProjectId() (map[string][]*entities.ApiKey,
 }
 
 func (fb *Firebase) GetApiKeysByProjectId(projectId string) ([]*entities.ApiKey, error) {
-	doc, err := fb.client.Collection(apiKeysCollection).Doc(projectId).Get(fb.ctx)
+	doc, err := fb.client.Collection(ApiKeysCollection).Doc(projectId).Get(fb.ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
 			return make([]*entities.ApiKey, 0), nil
@@ -224,6 +397,11 @@ func (fb *Firebase) GetApiKeysByProjectId(projectId string) ([]*entities.ApiKey,
 	return apiKeys.Keys, nil
 }
 
+func (fb *Firebase) UpdateApiKeys(projectId string, apiKeys *entities.ApiKeys) error {
+	_, err := fb.client.Collection(ApiKeysCollection).Doc(projectId).Set(fb.ctx, apiKeys)
+	return err
+}
+
 // Generates default key per project only in case if no other API key exists
 func (fb *Firebase) CreateDefaultApiKey(projectId string) error {
 	keys, err := fb.GetApiKeysByProjectId(projectId)
@@ -233,28 +411,17 @@ func (fb *Firebase) CreateDefaultApiKey(projectId string) error {
 	if len(keys) > 0 {
 		return nil
 	}
-	doc, err := fb.client.Collection(apiKeysCollection).Doc(projectId).Get(fb.ctx)
+	doc, err := fb.client.Collection(ApiKeysCollection).Doc(projectId).Get(fb.ctx)
 	if err != nil {
 		if status.Code(err) != codes.NotFound {
 			return fmt.Errorf("Error getting api keys by projectId [%s]: %v", projectId, err)
 		}
 	}
-	apiKeyRecord := fb.generateDefaultAPIToken(projectId)
+	apiKeyRecord := generateDefaultAPIToken(projectId)
 	_, err = doc.Ref.Create(fb.ctx, apiKeyRecord)
 	return err
 }
 
-func (fb *Firebase) generateDefaultAPIToken(projectId string) entities.ApiKeys {
-	return entities.ApiKeys{
-		LastUpdated: time.Now().UTC().Format(LastUpdatedLayout),
-		Keys: []*entities.ApiKey{{
-			Id:           projectId + "." + random.String(6),
-			ClientSecret: "js." + projectId + "." + random.String(21),
-			ServerSecret: "s2s." + projectId + "." + random.String(21),
-		}},
-	}
-}
-
 func (fb *Firebase) GetCustomDomains() (map[string]*entities.CustomDomains, error) {
 	var result = map[string]*entities.CustomDomains{}
 	iter := fb.client.Collection(customDomainsCollection).Documents(fb.ctx)
@@ -299,8 +466,12 @@ func (fb *Firebase) UpdateCustomDomain(projectId string, customDomains *entities
 }
 
 func (fb *Firebase) Close() (multiErr error) {
-	if err := fb.defaultDestination.Close(); err != nil {
-		multiErr = multierror.Append(multiErr, err)
+	fb.cancelWatch()
+
+	if fb.defaultDestination != nil {
+		if err := fb.defaultDestination.Close(); err != nil {
+			multiErr = multierror.Append(multiErr, err)
+		}
 	}
 
 	if err := fb.client.Close(); err != nil {
@@ -309,3 +480,15 @@ func (fb *Firebase) Close() (multiErr error) {
 
 	return
 }
+
+func firestoreLastUpdated(doc *firestore.DocumentSnapshot) string {
+	if !doc.Exists() {
+		return ""
+	}
+	value, err := doc.DataAt(lastUpdatedField)
+	if err != nil {
+		return ""
+	}
+	lastUpdated, _ := value.(string)
+	return lastUpdated
+}
@@ -0,0 +1,156 @@
+package storages
+
+import (
+	"fmt"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/safego"
+	"sync"
+	"time"
+)
+
+const externalChangeComment = "changed outside of the manager API"
+
+//DestinationsHistory keeps revisions of projects destinations. Every write through Save creates a revision.
+//Changes written directly into the storage (e.g. by UI) are recorded from the change feed
+type DestinationsHistory struct {
+	storage      Storage
+	subscription *Subscription
+	//mutex serializes Save and recording: otherwise the recorder might compare destinations read before Save
+	//with the revision added by Save and record the previous destinations as an external change
+	mutex sync.Mutex
+}
+
+func NewDestinationsHistory(storage Storage) *DestinationsHistory {
+	dh := &DestinationsHistory{storage: storage, subscription: storage.Changes().Subscribe(DestinationsCollection)}
+	dh.startRecorder()
+	return dh
+}
+
+//Save write project destinations with a new _lastUpdated and add the revision
+func (dh *DestinationsHistory) Save(projectId string, destinations []*entities.Destination, author, comment string) (*entities.DestinationsRevision, error) {
+	dh.mutex.Lock()
+	defer dh.mutex.Unlock()
+
+	now := time.Now().UTC()
+	revision, err := encryptedRevision(newRevision(now, destinations, author, comment))
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting destinations secrets of [%s] project: %v", projectId, err)
+	}
+	//revision is written first so the recorder doesn't treat the update as an external change.
+	//The revision is deleted if destinations aren't saved so history contains only saved destinations
+	if err := dh.storage.AddDestinationsRevision(projectId, revision); err != nil {
+		return nil, fmt.Errorf("Error saving destinations revision of [%s] project: %v", projectId, err)
+	}
+
+	if err := dh.storage.UpdateDestinations(projectId, &entities.Destinations{LastUpdated: now.Format(LastUpdatedLayout), Destinations: revision.Destinations}); err != nil {
+		if deleteErr := dh.storage.DeleteDestinationsRevision(projectId, revision.Id); deleteErr != nil {
+			logging.Errorf("Error deleting not saved destinations revision [%s] of [%s] project: %v", revision.Id, projectId, deleteErr)
+		}
+		return nil, fmt.Errorf("Error saving destinations of [%s] project: %v", projectId, err)
+	}
+	return revision, nil
+}
+
+//Revisions return all project destinations revisions from newest to oldest
+func (dh *DestinationsHistory) Revisions(projectId string) ([]*entities.DestinationsRevision, error) {
+	return dh.storage.GetDestinationsRevisions(projectId, 0)
+}
+
+//Rollback restore project destinations from the revision. Rollback is saved as a new revision
+func (dh *DestinationsHistory) Rollback(projectId, revisionId, author string) (*entities.DestinationsRevision, error) {
+	revision, err := dh.storage.GetDestinationsRevision(projectId, revisionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return dh.Save(projectId, revision.Destinations, author, "rollback to revision "+revisionId)
+}
+
+func (dh *DestinationsHistory) Close() error {
+	dh.subscription.Unsubscribe()
+	return nil
+}
+
+//startRecorder add revisions for destinations which were changed without Save
+func (dh *DestinationsHistory) startRecorder() {
+	safego.RunWithRestart(func() {
+		//the first storage sync might have happened before subscription
+		dh.recordAll()
+		for change := range dh.subscription.Changes {
+			//whole collection might have been changed (e.g. after reconnect)
+			if change.ProjectId == "" {
+				dh.recordAll()
+				continue
+			}
+
+			dh.recordProject(change.ProjectId)
+		}
+	})
+}
+
+func (dh *DestinationsHistory) recordProject(projectId string) {
+	dh.mutex.Lock()
+	defer dh.mutex.Unlock()
+
+	destinations, err := dh.storage.GetDestinationsByProjectId(projectId)
+	if err != nil {
+		logging.Errorf("Error recording destinations revision of [%s] project: %v", projectId, err)
+		return
+	}
+	dh.record(projectId, destinations)
+}
+
+func (dh *DestinationsHistory) recordAll() {
+	dh.mutex.Lock()
+	defer dh.mutex.Unlock()
+
+	destinationsByProject, err := dh.storage.GetDestinations()
+	if err != nil {
+		logging.Errorf("Error recording destinations revisions: %v", err)
+		return
+	}
+
+	for projectId, destinationsEntity := range destinationsByProject {
+		dh.record(projectId, destinationsEntity.Destinations)
+	}
+}
+
+//record add revision only if destinations differ from the last revision. Destinations are compared with decrypted secrets
+//because the same secret is encrypted into different strings and plaintext secrets might be written into the storage directly
+func (dh *DestinationsHistory) record(projectId string, projectDestinations []*entities.Destination) {
+	revision, err := encryptedRevision(newRevision(time.Now().UTC(), projectDestinations, "", externalChangeComment))
+	if err != nil {
+		logging.Errorf("Error recording destinations revision of [%s] project: %v", projectId, err)
+		return
+	}
+
+	lastRevisions, err := dh.storage.GetDestinationsRevisions(projectId, 1)
+	if err != nil {
+		logging.Errorf("Error getting last destinations revision of [%s] project: %v", projectId, err)
+		return
+	}
+
+	if len(lastRevisions) > 0 && destinations.EqualDestinations(lastRevisions[0].Destinations, revision.Destinations) {
+		return
+	}
+
+	if err := dh.storage.AddDestinationsRevision(projectId, revision); err != nil {
+		logging.Errorf("Error recording destinations revision of [%s] project: %v", projectId, err)
+	}
+}
+
+func newRevision(createdAt time.Time, destinations []*entities.Destination, author, comment string) *entities.DestinationsRevision {
+	if destinations == nil {
+		destinations = []*entities.Destination{}
+	}
+	return &entities.DestinationsRevision{
+		//zero padded nanoseconds are sorted in the same order as strings
+		Id:           fmt.Sprintf("%020d", createdAt.UnixNano()),
+		Author:       author,
+		CreatedAt:    createdAt.Format(LastUpdatedLayout),
+		Comment:      comment,
+		Destinations: destinations,
+	}
+}
@@ -0,0 +1,76 @@
+package storages
+
+import (
+	"errors"
+	"github.com/jitsucom/enhosted/entities"
+	"testing"
+)
+
+//failingUpdateStorage fails destinations updates
+type failingUpdateStorage struct {
+	Storage
+}
+
+func (fus *failingUpdateStorage) UpdateDestinations(projectId string, destinations *entities.Destinations) error {
+	return errors.New("update failed")
+}
+
+func TestDestinationsHistorySaveAndRollback(t *testing.T) {
+	storage, _, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+	history := NewDestinationsHistory(storage)
+	defer history.Close()
+
+	first, err := history.Save("project", []*entities.Destination{{Uid: "uid", Id: "first"}}, "user", "create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := history.Save("project", []*entities.Destination{{Uid: "uid", Id: "second"}}, "user", "update"); err != nil {
+		t.Fatal(err)
+	}
+
+	rollback, err := history.Rollback("project", first.Id, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rollback.Author != "admin" || rollback.Comment != "rollback to revision "+first.Id {
+		t.Errorf("unexpected rollback revision: %+v", rollback)
+	}
+	saved, err := storage.GetDestinationsByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Id != "first" {
+		t.Errorf("expected rolled back destinations, got %+v", saved)
+	}
+
+	revisions, err := history.Revisions("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[0].Id != rollback.Id || revisions[2].Id != first.Id {
+		t.Errorf("expected 3 revisions from newest to oldest, got %+v", revisions)
+	}
+
+	if _, err := history.Rollback("project", "unknown", "admin"); err != ErrNoFound {
+		t.Errorf("expected ErrNoFound, got %v", err)
+	}
+}
+
+func TestDestinationsHistoryFailedSave(t *testing.T) {
+	storage, _, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+	history := NewDestinationsHistory(&failingUpdateStorage{Storage: storage})
+	defer history.Close()
+
+	if _, err := history.Save("project", []*entities.Destination{{Uid: "uid", Id: "pg"}}, "user", "create"); err == nil {
+		t.Fatal("expected save error")
+	}
+	revisions, err := history.Revisions("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 0 {
+		t.Errorf("revision of not saved destinations must be deleted, got %+v", revisions)
+	}
+}
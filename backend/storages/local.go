@@ -0,0 +1,184 @@
+package storages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/enhosted/destinations"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const localFilePermission = 0600
+
+//localDriver keeps all collections in memory and persists them into a single json file on every write
+type localDriver struct {
+	sync.RWMutex
+
+	path string
+	//collection:id:document
+	collections map[string]map[string]json.RawMessage
+	changes     *ChangeFeed
+}
+
+//NewLocal return Storage which keeps all collections in a local json file (is used for local development and tests)
+func NewLocal(path string, defaultDestination *destinations.Postgres) (Storage, error) {
+	if path == "" {
+		return nil, errors.New("path is required to configure local storage")
+	}
+
+	driver := &localDriver{path: path, collections: map[string]map[string]json.RawMessage{}, changes: NewChangeFeed()}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Error reading local storage file [%s]: %v", path, err)
+		}
+	} else if len(b) > 0 {
+		if err := json.Unmarshal(b, &driver.collections); err != nil {
+			return nil, fmt.Errorf("Error parsing local storage file [%s]: %v", path, err)
+		}
+	}
+
+	//the file is written only by this process so the feed is always in sync after loading
+	for _, collection := range watchedCollections {
+		lastUpdated, err := driver.lastUpdated(collection)
+		if err != nil {
+			return nil, err
+		}
+		driver.changes.reset(collection, lastUpdated)
+	}
+
+	return &documentsStorage{
+		name:               "local file",
+		driver:             driver,
+		changes:            driver.changes,
+		defaultDestination: defaultDestination,
+	}, nil
+}
+
+func (ld *localDriver) get(collection, id string) ([]byte, error) {
+	ld.RLock()
+	defer ld.RUnlock()
+
+	data, ok := ld.collections[collection][id]
+	if !ok {
+		return nil, nil
+	}
+	return data, nil
+}
+
+func (ld *localDriver) getAll(collection string) (map[string][]byte, error) {
+	ld.RLock()
+	defer ld.RUnlock()
+
+	result := map[string][]byte{}
+	for id, data := range ld.collections[collection] {
+		result[id] = data
+	}
+	return result, nil
+}
+
+func (ld *localDriver) create(collection, id string, data []byte) (bool, error) {
+	ld.Lock()
+	defer ld.Unlock()
+
+	if _, ok := ld.collections[collection][id]; ok {
+		return false, nil
+	}
+	if err := ld.put(collection, id, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (ld *localDriver) set(collection, id string, data []byte) error {
+	ld.Lock()
+	defer ld.Unlock()
+
+	return ld.put(collection, id, data)
+}
+
+func (ld *localDriver) delete(collection, id string) error {
+	ld.Lock()
+	defer ld.Unlock()
+
+	documents := ld.collections[collection]
+	previous, ok := documents[id]
+	if !ok {
+		return nil
+	}
+	delete(documents, id)
+	if err := ld.flush(); err != nil {
+		documents[id] = previous
+		return err
+	}
+
+	ld.changes.notify(collection, id, "")
+	return nil
+}
+
+func (ld *localDriver) lastUpdated(collection string) (string, error) {
+	ld.RLock()
+	defer ld.RUnlock()
+
+	result := ""
+	for _, data := range ld.collections[collection] {
+		//LastUpdatedLayout has fixed length so values might be compared as strings
+		if lastUpdated := parseLastUpdated(data); lastUpdated > result {
+			result = lastUpdated
+		}
+	}
+	return result, nil
+}
+
+func (ld *localDriver) Close() error {
+	return nil
+}
+
+//put must be called under the write lock. In-memory state is rolled back if the file can't be written
+func (ld *localDriver) put(collection, id string, data []byte) error {
+	documents, ok := ld.collections[collection]
+	if !ok {
+		documents = map[string]json.RawMessage{}
+		ld.collections[collection] = documents
+	}
+
+	previous, existed := documents[id]
+	documents[id] = data
+	if err := ld.flush(); err != nil {
+		if existed {
+			documents[id] = previous
+		} else {
+			delete(documents, id)
+		}
+		return err
+	}
+
+	ld.changes.notify(collection, id, parseLastUpdated(data))
+	return nil
+}
+
+//flush write all collections into temporary file and rename it so the storage file is never partially written
+func (ld *localDriver) flush() error {
+	b, err := json.MarshalIndent(ld.collections, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error serializing local storage: %v", err)
+	}
+
+	if dir := filepath.Dir(ld.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("Error creating local storage directory [%s]: %v", dir, err)
+		}
+	}
+
+	tmpPath := ld.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, localFilePermission); err != nil {
+		return fmt.Errorf("Error writing local storage file [%s]: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, ld.path); err != nil {
+		return fmt.Errorf("Error renaming local storage file [%s] -> [%s]: %v", tmpPath, ld.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package storages
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//newTestLocalStorage return local storage in a temporary directory and the storage file path
+func newTestLocalStorage(t *testing.T) (Storage, string, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "db.json")
+	storage, err := NewLocal(path, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return storage, path, func() {
+		storage.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLocalStoragePersistence(t *testing.T) {
+	storage, path, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+
+	if err := storage.CreateDefaultApiKey("project"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := storage.GetApiKeysByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 default API key, got %d", len(keys))
+	}
+	//default key isn't created if the project has keys
+	if err := storage.CreateDefaultApiKey("project"); err != nil {
+		t.Fatal(err)
+	}
+
+	domains := &entities.CustomDomains{LastUpdated: "2021-01-02T00:00:00.000Z", Domains: []*entities.CustomDomain{{Name: "example.com", Status: "pending"}}}
+	if err := storage.UpdateCustomDomain("project", domains); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewLocal(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	reopenedKeys, err := reopened.GetApiKeysByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reopenedKeys, keys) {
+		t.Errorf("expected API keys %+v, got %+v", keys, reopenedKeys)
+	}
+	reopenedDomains, err := reopened.GetCustomDomainsByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reopenedDomains, domains) {
+		t.Errorf("expected custom domains %+v, got %+v", domains, reopenedDomains)
+	}
+	lastUpdated, err := reopened.GetApiKeysLastUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastUpdated == nil {
+		t.Error("API keys _lastUpdated is expected")
+	}
+}
+
+func TestLocalStorageNotFound(t *testing.T) {
+	storage, _, cleanup := newTestLocalStorage(t)
+	defer cleanup()
+
+	if _, err := storage.GetCustomDomainsByProjectId("unknown"); err != ErrNoFound {
+		t.Errorf("expected ErrNoFound, got %v", err)
+	}
+	keys, err := storage.GetApiKeysByProjectId("unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("expected no API keys, got %d", len(keys))
+	}
+}
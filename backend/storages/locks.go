@@ -0,0 +1,32 @@
+package storages
+
+import "sync"
+
+//apiKeysLocks serializes read-modify-write of project API keys (create, update, prune and purge) within the manager process
+var apiKeysLocks = newProjectLocks()
+
+//projectLocks keeps a mutex per project. Storages don't have transactions so concurrent changes of the same project document
+//must be serialized otherwise the last write silently discards the others
+type projectLocks struct {
+	sync.Mutex
+
+	locks map[string]*sync.Mutex
+}
+
+func newProjectLocks() *projectLocks {
+	return &projectLocks{locks: map[string]*sync.Mutex{}}
+}
+
+//lock acquire the project mutex and return the unlock function
+func (pl *projectLocks) lock(projectId string) func() {
+	pl.Lock()
+	projectLock, ok := pl.locks[projectId]
+	if !ok {
+		projectLock = &sync.Mutex{}
+		pl.locks[projectId] = projectLock
+	}
+	pl.Unlock()
+
+	projectLock.Lock()
+	return projectLock.Unlock
+}
@@ -0,0 +1,308 @@
+package storages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/eventnative/logging"
+	"reflect"
+	"sort"
+	"time"
+)
+
+//CollectionReport is a migration result of one collection
+type CollectionReport struct {
+	Collection string
+	Source     int
+	Target     int
+	New        []string
+	Changed    []string
+	Unchanged  int
+	//Skipped are changed documents which can't be overwritten (destinations revisions are immutable)
+	Skipped []string
+}
+
+func (cr *CollectionReport) String() string {
+	return fmt.Sprintf("[%s] source: %d target: %d new: %d changed: %d unchanged: %d skipped: %d",
+		cr.Collection, cr.Source, cr.Target, len(cr.New), len(cr.Changed), cr.Unchanged, len(cr.Skipped))
+}
+
+//Migrate copy all collections from source to target storage. Target documents with the same project id are overwritten.
+//Destinations revisions and connection tests are copied for projects with destinations (they are written only for them):
+//documents are reported as <project id>/<revision id> and <project id>/<destination uid>.
+//If dryRun is true target storage isn't modified, only reports are returned
+func Migrate(source, target Storage, dryRun bool) ([]*CollectionReport, error) {
+	var reports []*CollectionReport
+
+	report, err := migrateDatabases(source, target, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, report)
+
+	report, err = migrateDestinations(source, target, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, report)
+
+	report, err = migrateRevisions(source, target, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, report)
+
+	report, err = migrateConnectionTests(source, target, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, report)
+
+	report, err = migrateApiKeys(source, target, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, report)
+
+	report, err = migrateCustomDomains(source, target, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, report)
+
+	return reports, nil
+}
+
+func migrateDatabases(source, target Storage, dryRun bool) (*CollectionReport, error) {
+	sourceDatabases, err := source.GetDatabases()
+	if err != nil {
+		return nil, err
+	}
+	targetDatabases, err := target.GetDatabases()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CollectionReport{Collection: defaultDatabaseCredentialsCollection, Source: len(sourceDatabases), Target: len(targetDatabases)}
+	for _, projectId := range sortedKeys(sourceDatabases) {
+		database := sourceDatabases[projectId]
+		targetDatabase, exists := targetDatabases[projectId]
+		if !report.compare(projectId, database, targetDatabase, exists) || dryRun {
+			continue
+		}
+		if err := target.UpdateDatabase(projectId, database); err != nil {
+			return nil, fmt.Errorf("Error writing database of [%s] project: %v", projectId, err)
+		}
+	}
+	return report, nil
+}
+
+func migrateDestinations(source, target Storage, dryRun bool) (*CollectionReport, error) {
+	sourceDestinations, err := source.GetDestinations()
+	if err != nil {
+		return nil, err
+	}
+	targetDestinations, err := target.GetDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CollectionReport{Collection: DestinationsCollection, Source: len(sourceDestinations), Target: len(targetDestinations)}
+	for _, projectId := range sortedKeys(sourceDestinations) {
+		destinationsEntity := sourceDestinations[projectId]
+		targetDestinationsEntity, exists := targetDestinations[projectId]
+		//secrets are compared decrypted: the same secret is encrypted into different strings
+		equal := exists && destinationsEntity.LastUpdated == targetDestinationsEntity.LastUpdated &&
+			destinations.EqualDestinations(destinationsEntity.Destinations, targetDestinationsEntity.Destinations)
+		if !report.add(projectId, exists, equal) || dryRun {
+			continue
+		}
+		if err := target.UpdateDestinations(projectId, destinationsEntity); err != nil {
+			return nil, fmt.Errorf("Error writing destinations of [%s] project: %v", projectId, err)
+		}
+	}
+	return report, nil
+}
+
+func migrateRevisions(source, target Storage, dryRun bool) (*CollectionReport, error) {
+	sourceDestinations, err := source.GetDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CollectionReport{Collection: destinationsHistoryCollection}
+	for _, projectId := range sortedKeys(sourceDestinations) {
+		revisions, err := source.GetDestinationsRevisions(projectId, 0)
+		if err != nil {
+			return nil, err
+		}
+		targetRevisions, err := target.GetDestinationsRevisions(projectId, 0)
+		if err != nil {
+			return nil, err
+		}
+		report.Source += len(revisions)
+		report.Target += len(targetRevisions)
+
+		targetById := map[string]*entities.DestinationsRevision{}
+		for _, revision := range targetRevisions {
+			targetById[revision.Id] = revision
+		}
+		//revisions are written from oldest to newest
+		for i := len(revisions) - 1; i >= 0; i-- {
+			revision := revisions[i]
+			key := projectId + "/" + revision.Id
+			targetRevision, exists := targetById[revision.Id]
+			if exists {
+				if sameRevision(revision, targetRevision) {
+					report.Unchanged++
+				} else {
+					logging.Warnf("Destinations revision [%s] differs in the target storage and isn't overwritten", key)
+					report.Skipped = append(report.Skipped, key)
+				}
+				continue
+			}
+
+			report.New = append(report.New, key)
+			if dryRun {
+				continue
+			}
+			if err := target.AddDestinationsRevision(projectId, revision); err != nil {
+				return nil, fmt.Errorf("Error writing destinations revision [%s]: %v", key, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+//sameRevision return true if revisions have the same metadata and destinations with decrypted secrets
+func sameRevision(first, second *entities.DestinationsRevision) bool {
+	return first.Author == second.Author && first.CreatedAt == second.CreatedAt && first.Comment == second.Comment &&
+		destinations.EqualDestinations(first.Destinations, second.Destinations)
+}
+
+func migrateConnectionTests(source, target Storage, dryRun bool) (*CollectionReport, error) {
+	sourceDestinations, err := source.GetDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CollectionReport{Collection: connectionTestsCollection}
+	for _, projectId := range sortedKeys(sourceDestinations) {
+		tests, err := source.GetConnectionTests(projectId)
+		if err != nil {
+			return nil, err
+		}
+		targetTests, err := target.GetConnectionTests(projectId)
+		if err != nil {
+			return nil, err
+		}
+		report.Source += len(tests)
+		report.Target += len(targetTests)
+
+		targetByUid := map[string]*entities.ConnectionTest{}
+		for _, test := range targetTests {
+			targetByUid[test.DestinationUid] = test
+		}
+		for _, test := range tests {
+			targetTest, exists := targetByUid[test.DestinationUid]
+			if !report.compare(projectId+"/"+test.DestinationUid, test, targetTest, exists) || dryRun {
+				continue
+			}
+			if err := target.SaveConnectionTest(projectId, test); err != nil {
+				return nil, fmt.Errorf("Error writing connection test of [%s] destination of [%s] project: %v", test.DestinationUid, projectId, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func migrateApiKeys(source, target Storage, dryRun bool) (*CollectionReport, error) {
+	sourceKeys, err := source.GetApiKeysGroupByProjectId()
+	if err != nil {
+		return nil, err
+	}
+	targetKeys, err := target.GetApiKeysGroupByProjectId()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CollectionReport{Collection: ApiKeysCollection, Source: len(sourceKeys), Target: len(targetKeys)}
+	lastUpdated := time.Now().UTC().Format(LastUpdatedLayout)
+	for _, projectId := range sortedKeys(sourceKeys) {
+		keys := sourceKeys[projectId]
+		projectTargetKeys, exists := targetKeys[projectId]
+		if !report.compare(projectId, keys, projectTargetKeys, exists) || dryRun {
+			continue
+		}
+		//grouped keys don't contain _lastUpdated so it is set to migration time
+		if err := target.UpdateApiKeys(projectId, &entities.ApiKeys{LastUpdated: lastUpdated, Keys: keys}); err != nil {
+			return nil, fmt.Errorf("Error writing API keys of [%s] project: %v", projectId, err)
+		}
+	}
+	return report, nil
+}
+
+func migrateCustomDomains(source, target Storage, dryRun bool) (*CollectionReport, error) {
+	sourceDomains, err := source.GetCustomDomains()
+	if err != nil {
+		return nil, err
+	}
+	targetDomains, err := target.GetCustomDomains()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CollectionReport{Collection: customDomainsCollection, Source: len(sourceDomains), Target: len(targetDomains)}
+	for _, projectId := range sortedKeys(sourceDomains) {
+		domains := sourceDomains[projectId]
+		projectTargetDomains, exists := targetDomains[projectId]
+		if !report.compare(projectId, domains, projectTargetDomains, exists) || dryRun {
+			continue
+		}
+		if err := target.UpdateCustomDomain(projectId, domains); err != nil {
+			return nil, fmt.Errorf("Error writing custom domains of [%s] project: %v", projectId, err)
+		}
+	}
+	return report, nil
+}
+
+//compare put key into new or changed list and return true if the document should be written
+func (cr *CollectionReport) compare(key string, source, target interface{}, exists bool) bool {
+	if !exists {
+		return cr.add(key, false, false)
+	}
+
+	sourceBytes, sourceErr := json.Marshal(source)
+	targetBytes, targetErr := json.Marshal(target)
+	if sourceErr != nil || targetErr != nil {
+		logging.Warnf("Error comparing [%s] documents [%s]. It will be overwritten", cr.Collection, key)
+		return cr.add(key, true, false)
+	}
+	return cr.add(key, true, bytes.Equal(sourceBytes, targetBytes))
+}
+
+//add put key into new or changed list and return true if the document should be written
+func (cr *CollectionReport) add(key string, exists, equal bool) bool {
+	switch {
+	case !exists:
+		cr.New = append(cr.New, key)
+	case equal:
+		cr.Unchanged++
+		return false
+	default:
+		cr.Changed = append(cr.Changed, key)
+	}
+	return true
+}
+
+//sortedKeys return keys of projectId:value map in stable order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,101 @@
+package storages
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"reflect"
+	"testing"
+)
+
+func reportsByCollection(reports []*CollectionReport) map[string]*CollectionReport {
+	result := map[string]*CollectionReport{}
+	for _, report := range reports {
+		result[report.Collection] = report
+	}
+	return result
+}
+
+func TestMigrate(t *testing.T) {
+	source, _, cleanupSource := newTestLocalStorage(t)
+	defer cleanupSource()
+	target, _, cleanupTarget := newTestLocalStorage(t)
+	defer cleanupTarget()
+
+	lastUpdated := "2021-01-02T00:00:00.000Z"
+	destinations := &entities.Destinations{LastUpdated: lastUpdated, Destinations: []*entities.Destination{
+		{Uid: "uid", Id: "pg", Type: "postgres", Data: map[string]interface{}{"pghost": "host", "pgpassword": "secret"}}}}
+	if err := source.UpdateDestinations("project", destinations); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.UpdateApiKeys("project", &entities.ApiKeys{LastUpdated: lastUpdated, Keys: []*entities.ApiKey{{Id: "key"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := target.UpdateApiKeys("project", &entities.ApiKeys{LastUpdated: lastUpdated, Keys: []*entities.ApiKey{{Id: "old"}}}); err != nil {
+		t.Fatal(err)
+	}
+	revision := &entities.DestinationsRevision{Id: "1", CreatedAt: lastUpdated, Destinations: destinations.Destinations}
+	if err := source.AddDestinationsRevision("project", revision); err != nil {
+		t.Fatal(err)
+	}
+	test := &entities.ConnectionTest{DestinationUid: "uid", Ok: true, TestedAt: lastUpdated}
+	if err := source.SaveConnectionTest("project", test); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := Migrate(source, target, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byCollection := reportsByCollection(reports)
+	expectedNew := map[string][]string{
+		DestinationsCollection:        {"project"},
+		destinationsHistoryCollection: {"project/1"},
+		connectionTestsCollection:     {"project/uid"},
+		ApiKeysCollection:             nil,
+	}
+	for collection, expected := range expectedNew {
+		report, ok := byCollection[collection]
+		if !ok {
+			t.Fatalf("[%s] report is absent", collection)
+		}
+		if !reflect.DeepEqual(report.New, expected) {
+			t.Errorf("[%s] expected new %v, got %v", collection, expected, report.New)
+		}
+	}
+	if changed := byCollection[ApiKeysCollection].Changed; !reflect.DeepEqual(changed, []string{"project"}) {
+		t.Errorf("expected changed API keys of project, got %v", changed)
+	}
+	if migrated, _ := target.GetDestinations(); len(migrated) != 0 {
+		t.Fatal("target storage is modified in dry run")
+	}
+
+	if _, err := Migrate(source, target, false); err != nil {
+		t.Fatal(err)
+	}
+	migrated, err := target.GetDestinationsByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 1 || migrated[0].Uid != "uid" {
+		t.Errorf("unexpected migrated destinations: %+v", migrated)
+	}
+	if _, err := target.GetDestinationsRevision("project", "1"); err != nil {
+		t.Errorf("revision isn't migrated: %v", err)
+	}
+	if tests, _ := target.GetConnectionTests("project"); len(tests) != 1 || !reflect.DeepEqual(tests[0], test) {
+		t.Errorf("unexpected migrated connection tests: %+v", tests)
+	}
+	if keys, _ := target.GetApiKeysByProjectId("project"); len(keys) != 1 || keys[0].Id != "key" {
+		t.Errorf("unexpected migrated API keys: %+v", keys)
+	}
+
+	//the second migration doesn't change anything
+	reports, err = Migrate(source, target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		if len(report.New) > 0 || len(report.Changed) > 0 || len(report.Skipped) > 0 {
+			t.Errorf("expected unchanged [%s], got %s", report.Collection, report.String())
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package storages
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/safego"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"time"
+)
+
+const (
+	createDocumentsTableQuery = `CREATE TABLE IF NOT EXISTS manager_documents (
+									collection text NOT NULL,
+									id text NOT NULL,
+									data jsonb NOT NULL,
+									PRIMARY KEY (collection, id))`
+	selectDocumentQuery    = `SELECT data FROM manager_documents WHERE collection = $1 AND id = $2`
+	selectDocumentsQuery   = `SELECT id, data FROM manager_documents WHERE collection = $1`
+	selectLastUpdatedQuery = `SELECT data->>'_lastUpdated' FROM manager_documents
+								WHERE collection = $1 AND data->>'_lastUpdated' IS NOT NULL
+								ORDER BY data->>'_lastUpdated' DESC LIMIT 1`
+	insertDocumentQuery = `INSERT INTO manager_documents (collection, id, data) VALUES ($1, $2, $3)
+								ON CONFLICT (collection, id) DO NOTHING`
+	upsertDocumentQuery = `INSERT INTO manager_documents (collection, id, data) VALUES ($1, $2, $3)
+								ON CONFLICT (collection, id) DO UPDATE SET data = EXCLUDED.data`
+	deleteDocumentQuery = `DELETE FROM manager_documents WHERE collection = $1 AND id = $2`
+	notifyQuery         = `SELECT pg_notify($1, $2)`
+
+	changesChannel = "manager_documents_changes"
+)
+
+//documentChange is a payload of postgres notification about written document
+type documentChange struct {
+	Collection  string `json:"collection"`
+	Id          string `json:"id"`
+	LastUpdated string `json:"lastUpdated"`
+}
+
+//postgresDriver keeps every collection document as jsonb row in one table.
+//Every write is published with NOTIFY so all manager instances keep their change feeds in sync
+type postgresDriver struct {
+	ctx        context.Context
+	dataSource *sql.DB
+	listener   *pq.Listener
+	changes    *ChangeFeed
+}
+
+//NewPostgres return Storage which keeps all collections in postgres
+func NewPostgres(ctx context.Context, postgresViper *viper.Viper, defaultDestination *destinations.Postgres) (Storage, error) {
+	port := postgresViper.GetInt("port")
+	if port == 0 {
+		port = 5432
+	}
+	dsConfig := &destinations.DatasourceConfig{
+		Host:     postgresViper.GetString("host"),
+		Port:     port,
+		Db:       postgresViper.GetString("database"),
+		Username: postgresViper.GetString("username"),
+		Password: postgresViper.GetString("password"),
+	}
+	if dsConfig.Host == "" || dsConfig.Username == "" || dsConfig.Db == "" {
+		return nil, errors.New("host, database and username are required to configure postgres storage")
+	}
+
+	dataSource, err := sql.Open("postgres", dsConfig.ConnectionString())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dataSource.Ping(); err != nil {
+		dataSource.Close()
+		return nil, err
+	}
+
+	if _, err := dataSource.ExecContext(ctx, createDocumentsTableQuery); err != nil {
+		dataSource.Close()
+		return nil, fmt.Errorf("Error creating postgres storage table: %v", err)
+	}
+
+	driver := &postgresDriver{ctx: ctx, dataSource: dataSource, changes: NewChangeFeed()}
+	driver.listener = pq.NewListener(dsConfig.ConnectionString(), 10*time.Second, time.Minute, driver.onListenerEvent)
+	if err := driver.listener.Listen(changesChannel); err != nil {
+		driver.listener.Close()
+		dataSource.Close()
+		return nil, fmt.Errorf("Error listening to postgres storage changes: %v", err)
+	}
+	safego.RunWithRestart(driver.listen)
+
+	return &documentsStorage{
+		name:               "postgres",
+		driver:             driver,
+		changes:            driver.changes,
+		defaultDestination: defaultDestination,
+	}, nil
+}
+
+//onListenerEvent resync the change feed after (re)connect because notifications might have been missed
+func (pd *postgresDriver) onListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		for _, collection := range watchedCollections {
+			lastUpdated, err := pd.lastUpdated(collection)
+			if err != nil {
+				logging.Errorf("Error getting postgres storage [%s] %s: %v", collection, lastUpdatedField, err)
+				pd.changes.desync(collection)
+				continue
+			}
+			pd.changes.reset(collection, lastUpdated)
+		}
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		logging.Errorf("Postgres storage changes listener is disconnected: %v", err)
+		for _, collection := range watchedCollections {
+			pd.changes.desync(collection)
+		}
+	}
+}
+
+func (pd *postgresDriver) listen() {
+	for notification := range pd.listener.Notify {
+		//nil notification is sent after reconnect, it is handled in onListenerEvent
+		if notification == nil {
+			continue
+		}
+
+		change := &documentChange{}
+		if err := json.Unmarshal([]byte(notification.Extra), change); err != nil {
+			logging.Errorf("Error parsing postgres storage change [%s]: %v", notification.Extra, err)
+			continue
+		}
+		pd.changes.notify(change.Collection, change.Id, change.LastUpdated)
+	}
+}
+
+func (pd *postgresDriver) get(collection, id string) ([]byte, error) {
+	var data []byte
+	err := pd.dataSource.QueryRowContext(pd.ctx, selectDocumentQuery, collection, id).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (pd *postgresDriver) getAll(collection string) (map[string][]byte, error) {
+	rows, err := pd.dataSource.QueryContext(pd.ctx, selectDocumentsQuery, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string][]byte{}
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		result[id] = data
+	}
+
+	return result, rows.Err()
+}
+
+func (pd *postgresDriver) create(collection, id string, data []byte) (bool, error) {
+	result, err := pd.dataSource.ExecContext(pd.ctx, insertDocumentQuery, collection, id, data)
+	if err != nil {
+		return false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	pd.publishChange(collection, id, data)
+	return true, nil
+}
+
+func (pd *postgresDriver) set(collection, id string, data []byte) error {
+	if _, err := pd.dataSource.ExecContext(pd.ctx, upsertDocumentQuery, collection, id, data); err != nil {
+		return err
+	}
+
+	pd.publishChange(collection, id, data)
+	return nil
+}
+
+func (pd *postgresDriver) delete(collection, id string) error {
+	if _, err := pd.dataSource.ExecContext(pd.ctx, deleteDocumentQuery, collection, id); err != nil {
+		return err
+	}
+
+	pd.publishChange(collection, id, nil)
+	return nil
+}
+
+//publishChange send NOTIFY to all listeners (including this instance). The document is already written so errors are only logged
+func (pd *postgresDriver) publishChange(collection, id string, data []byte) {
+	payload, err := json.Marshal(documentChange{Collection: collection, Id: id, LastUpdated: parseLastUpdated(data)})
+	if err != nil {
+		logging.Errorf("Error serializing postgres storage change of [%s] document of [%s] collection: %v", id, collection, err)
+		return
+	}
+
+	if _, err := pd.dataSource.ExecContext(pd.ctx, notifyQuery, changesChannel, string(payload)); err != nil {
+		logging.Errorf("Error notifying about change of [%s] document of [%s] collection: %v", id, collection, err)
+	}
+}
+
+func (pd *postgresDriver) lastUpdated(collection string) (string, error) {
+	var lastUpdated string
+	err := pd.dataSource.QueryRowContext(pd.ctx, selectLastUpdatedQuery, collection).Scan(&lastUpdated)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return lastUpdated, nil
+}
+
+func (pd *postgresDriver) Close() (multiErr error) {
+	if err := pd.listener.Close(); err != nil {
+		multiErr = multierror.Append(multiErr, fmt.Errorf("Error closing postgres changes listener: %v", err))
+	}
+
+	if err := pd.dataSource.Close(); err != nil {
+		multiErr = multierror.Append(multiErr, err)
+	}
+
+	return
+}
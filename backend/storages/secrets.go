@@ -0,0 +1,81 @@
+package storages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+)
+
+//encryptedDestinations return destinations entity copy with encrypted secrets. Every storage encrypts destinations before writing
+func encryptedDestinations(destinationsEntity *entities.Destinations) (*entities.Destinations, error) {
+	encrypted, err := destinations.EncryptSecrets(destinationsEntity.Destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	result := *destinationsEntity
+	result.Destinations = encrypted
+	return &result, nil
+}
+
+//encryptedRevision return revision copy with encrypted secrets
+func encryptedRevision(revision *entities.DestinationsRevision) (*entities.DestinationsRevision, error) {
+	encrypted, err := destinations.EncryptSecrets(revision.Destinations)
+	if err != nil {
+		return nil, err
+	}
+
+	result := *revision
+	result.Destinations = encrypted
+	return &result, nil
+}
+
+//EncryptSecrets encrypt plaintext destinations secrets (e.g. written by UI directly into the storage) and rewrap secrets
+//which were encrypted with not current master key. _lastUpdated isn't changed because decrypted configurations stay the same.
+//Return ids of projects which destinations have been (or would be if dryRun is true) rewritten
+func EncryptSecrets(storage Storage, dryRun bool) ([]string, error) {
+	destinationsByProject, err := storage.GetDestinations()
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for _, projectId := range sortedKeys(destinationsByProject) {
+		destinationsEntity := destinationsByProject[projectId]
+		encrypted, err := encryptedDestinations(destinationsEntity)
+		if err != nil {
+			return nil, fmt.Errorf("Error encrypting destinations of [%s] project: %v", projectId, err)
+		}
+		if equalDestinations(destinationsEntity.Destinations, encrypted.Destinations) {
+			continue
+		}
+
+		changed = append(changed, projectId)
+		if dryRun {
+			continue
+		}
+		if err := storage.UpdateDestinations(projectId, encrypted); err != nil {
+			return nil, fmt.Errorf("Error writing destinations of [%s] project: %v", projectId, err)
+		}
+	}
+	return changed, nil
+}
+
+//equalDestinations return true if destinations are stored the same
+func equalDestinations(first, second []*entities.Destination) bool {
+	if len(first) == 0 && len(second) == 0 {
+		return true
+	}
+
+	firstBytes, err := json.Marshal(first)
+	if err != nil {
+		return false
+	}
+	secondBytes, err := json.Marshal(second)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(firstBytes, secondBytes)
+}
@@ -0,0 +1,296 @@
+package storages
+
+import (
+	"errors"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/jitsucom/eventnative/safego"
+	"time"
+)
+
+const purgePeriod = time.Hour
+
+//ErrDestinationIdConflict is returned on restoring destination when the project has a live destination with the same _id
+var ErrDestinationIdConflict = errors.New("Destination with the same _id already exists")
+
+//SoftDeletion marks destinations, API keys and custom domains as deleted with _deletedAt tombstone instead of removing them.
+//Tombstones might be restored during the retention period. After that they are purged by the background job
+type SoftDeletion struct {
+	storage   Storage
+	history   *DestinationsHistory
+	retention time.Duration
+
+	closed chan struct{}
+}
+
+func NewSoftDeletion(storage Storage, history *DestinationsHistory, retention time.Duration) *SoftDeletion {
+	sd := &SoftDeletion{storage: storage, history: history, retention: retention, closed: make(chan struct{})}
+	sd.startPurging()
+	return sd
+}
+
+//DeleteDestination put tombstone into the project destination. Deleting of already deleted destination is a no-op
+func (sd *SoftDeletion) DeleteDestination(projectId, uid, author string) error {
+	return sd.updateDestination(projectId, uid, author, "delete destination "+uid, func(destination *entities.Destination, projectDestinations []*entities.Destination) bool {
+		if destination.IsDeleted() {
+			return false
+		}
+		destination.DeletedAt = time.Now().UTC().Format(LastUpdatedLayout)
+		return true
+	})
+}
+
+//RestoreDestination remove tombstone from the project destination.
+//Return ErrDestinationIdConflict if the destination _id has been taken by another live destination after deletion
+func (sd *SoftDeletion) RestoreDestination(projectId, uid, author string) error {
+	var conflict bool
+	err := sd.updateDestination(projectId, uid, author, "restore destination "+uid, func(destination *entities.Destination, projectDestinations []*entities.Destination) bool {
+		if !destination.IsDeleted() {
+			return false
+		}
+		for _, another := range projectDestinations {
+			if another.Id == destination.Id && another.Uid != destination.Uid && !another.IsDeleted() {
+				conflict = true
+				return false
+			}
+		}
+		destination.DeletedAt = ""
+		return true
+	})
+	if err == nil && conflict {
+		return ErrDestinationIdConflict
+	}
+	return err
+}
+
+//DeleteApiKey put tombstone into the project API key. Deleting of already deleted key is a no-op
+func (sd *SoftDeletion) DeleteApiKey(projectId, id string) error {
+	return sd.updateApiKey(projectId, id, func(apiKey *entities.ApiKey) bool {
+		if apiKey.IsDeleted() {
+			return false
+		}
+		apiKey.DeletedAt = time.Now().UTC().Format(LastUpdatedLayout)
+		return true
+	})
+}
+
+//RestoreApiKey remove tombstone from the project API key. Revoked keys can't be restored
+func (sd *SoftDeletion) RestoreApiKey(projectId, id string) error {
+	var revoked bool
+	err := sd.updateApiKey(projectId, id, func(apiKey *entities.ApiKey) bool {
+		if apiKey.IsRevoked() {
+			revoked = true
+			return false
+		}
+		if !apiKey.IsDeleted() {
+			return false
+		}
+		apiKey.DeletedAt = ""
+		return true
+	})
+	if err == nil && revoked {
+		return ErrApiKeyRevoked
+	}
+	return err
+}
+
+//DeleteCustomDomain put tombstone into the project custom domain. Deleting of already deleted domain is a no-op
+func (sd *SoftDeletion) DeleteCustomDomain(projectId, name string) error {
+	return sd.updateCustomDomain(projectId, name, func(domain *entities.CustomDomain) bool {
+		if domain.IsDeleted() {
+			return false
+		}
+		domain.DeletedAt = time.Now().UTC().Format(LastUpdatedLayout)
+		return true
+	})
+}
+
+//RestoreCustomDomain remove tombstone from the project custom domain
+func (sd *SoftDeletion) RestoreCustomDomain(projectId, name string) error {
+	return sd.updateCustomDomain(projectId, name, func(domain *entities.CustomDomain) bool {
+		if !domain.IsDeleted() {
+			return false
+		}
+		domain.DeletedAt = ""
+		return true
+	})
+}
+
+func (sd *SoftDeletion) Close() error {
+	close(sd.closed)
+	return nil
+}
+
+//updateDestination apply change to the destination and save destinations with a new revision if the change returns true.
+//Return ErrNoFound if there is no destination with the uid
+func (sd *SoftDeletion) updateDestination(projectId, uid, author, comment string, change func(destination *entities.Destination, projectDestinations []*entities.Destination) bool) error {
+	projectDestinations, err := sd.storage.GetDestinationsByProjectId(projectId)
+	if err != nil {
+		return err
+	}
+
+	for _, destination := range projectDestinations {
+		if destination.Uid != uid {
+			continue
+		}
+		if !change(destination, projectDestinations) {
+			return nil
+		}
+		_, err := sd.history.Save(projectId, projectDestinations, author, comment)
+		return err
+	}
+	return ErrNoFound
+}
+
+func (sd *SoftDeletion) updateApiKey(projectId, id string, change func(apiKey *entities.ApiKey) bool) error {
+	return updateApiKey(sd.storage, projectId, id, change)
+}
+
+//updateCustomDomain apply change to the domain and save domains if the change returns true.
+//_lastUpdated isn't changed because it is the last certificate update time.
+//Return ErrNoFound if there is no domain with the name
+func (sd *SoftDeletion) updateCustomDomain(projectId, name string, change func(domain *entities.CustomDomain) bool) error {
+	domains, err := sd.storage.GetCustomDomainsByProjectId(projectId)
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range domains.Domains {
+		if domain.Name != name {
+			continue
+		}
+		if !change(domain) {
+			return nil
+		}
+		return sd.storage.UpdateCustomDomain(projectId, domains)
+	}
+	return ErrNoFound
+}
+
+func (sd *SoftDeletion) startPurging() {
+	safego.RunWithRestart(func() {
+		ticker := time.NewTicker(purgePeriod)
+		defer ticker.Stop()
+		for {
+			sd.purge()
+			select {
+			case <-sd.closed:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+//purge remove tombstones which are older than retention period
+func (sd *SoftDeletion) purge() {
+	expired := func(deletedAt string) bool {
+		if deletedAt == "" {
+			return false
+		}
+		t, err := time.Parse(LastUpdatedLayout, deletedAt)
+		if err != nil {
+			logging.Errorf("Error parsing _deletedAt [%s]: %v", deletedAt, err)
+			return false
+		}
+		return time.Now().UTC().Sub(t) > sd.retention
+	}
+
+	sd.purgeDestinations(expired)
+	sd.purgeApiKeys(expired)
+	sd.purgeCustomDomains(expired)
+}
+
+func (sd *SoftDeletion) purgeDestinations(expired func(deletedAt string) bool) {
+	destinationsByProject, err := sd.storage.GetDestinations()
+	if err != nil {
+		logging.Errorf("Error purging deleted destinations: %v", err)
+		return
+	}
+
+	for projectId, destinationsEntity := range destinationsByProject {
+		var alive []*entities.Destination
+		for _, destination := range destinationsEntity.Destinations {
+			if !expired(destination.DeletedAt) {
+				alive = append(alive, destination)
+			}
+		}
+		if len(alive) == len(destinationsEntity.Destinations) {
+			continue
+		}
+
+		if _, err := sd.history.Save(projectId, alive, "", "purge deleted destinations"); err != nil {
+			logging.Errorf("Error purging deleted destinations of [%s] project: %v", projectId, err)
+			continue
+		}
+		logging.Infof("Purged %d deleted destinations of [%s] project", len(destinationsEntity.Destinations)-len(alive), projectId)
+	}
+}
+
+func (sd *SoftDeletion) purgeApiKeys(expired func(deletedAt string) bool) {
+	keysByProject, err := sd.storage.GetApiKeysGroupByProjectId()
+	if err != nil {
+		logging.Errorf("Error purging deleted API keys: %v", err)
+		return
+	}
+
+	for projectId := range keysByProject {
+		sd.purgeProjectApiKeys(projectId, expired)
+	}
+}
+
+//purgeProjectApiKeys re-read project keys under the project lock so concurrent changes aren't overwritten
+func (sd *SoftDeletion) purgeProjectApiKeys(projectId string, expired func(deletedAt string) bool) {
+	unlock := apiKeysLocks.lock(projectId)
+	defer unlock()
+
+	keys, err := sd.storage.GetApiKeysByProjectId(projectId)
+	if err != nil {
+		logging.Errorf("Error purging deleted API keys of [%s] project: %v", projectId, err)
+		return
+	}
+
+	alive := []*entities.ApiKey{}
+	for _, apiKey := range keys {
+		if !expired(apiKey.DeletedAt) {
+			alive = append(alive, apiKey)
+		}
+	}
+	if len(alive) == len(keys) {
+		return
+	}
+
+	if err := sd.storage.UpdateApiKeys(projectId, &entities.ApiKeys{LastUpdated: time.Now().UTC().Format(LastUpdatedLayout), Keys: alive}); err != nil {
+		logging.Errorf("Error purging deleted API keys of [%s] project: %v", projectId, err)
+		return
+	}
+	logging.Infof("Purged %d deleted API keys of [%s] project", len(keys)-len(alive), projectId)
+}
+
+func (sd *SoftDeletion) purgeCustomDomains(expired func(deletedAt string) bool) {
+	domainsByProject, err := sd.storage.GetCustomDomains()
+	if err != nil {
+		logging.Errorf("Error purging deleted custom domains: %v", err)
+		return
+	}
+
+	for projectId, domains := range domainsByProject {
+		alive := []*entities.CustomDomain{}
+		for _, domain := range domains.Domains {
+			if !expired(domain.DeletedAt) {
+				alive = append(alive, domain)
+			}
+		}
+		if len(alive) == len(domains.Domains) {
+			continue
+		}
+
+		purged := len(domains.Domains) - len(alive)
+		domains.Domains = alive
+		if err := sd.storage.UpdateCustomDomain(projectId, domains); err != nil {
+			logging.Errorf("Error purging deleted custom domains of [%s] project: %v", projectId, err)
+			continue
+		}
+		logging.Infof("Purged %d deleted custom domains of [%s] project", purged, projectId)
+	}
+}
@@ -0,0 +1,127 @@
+package storages
+
+import (
+	"github.com/jitsucom/enhosted/entities"
+	"testing"
+	"time"
+)
+
+//newTestSoftDeletion return SoftDeletion on a temporary local storage without the purging job
+func newTestSoftDeletion(t *testing.T, retention time.Duration) (*SoftDeletion, func()) {
+	storage, _, cleanup := newTestLocalStorage(t)
+	history := NewDestinationsHistory(storage)
+	return &SoftDeletion{storage: storage, history: history, retention: retention, closed: make(chan struct{})}, func() {
+		history.Close()
+		cleanup()
+	}
+}
+
+func projectDestination(t *testing.T, storage Storage, uid string) *entities.Destination {
+	projectDestinations, err := storage.GetDestinationsByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, destination := range projectDestinations {
+		if destination.Uid == uid {
+			return destination
+		}
+	}
+	return nil
+}
+
+func TestSoftDeletionDestinations(t *testing.T) {
+	sd, cleanup := newTestSoftDeletion(t, time.Hour)
+	defer cleanup()
+	if _, err := sd.history.Save("project", []*entities.Destination{{Uid: "first", Id: "pg"}}, "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sd.DeleteDestination("project", "first", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if destination := projectDestination(t, sd.storage, "first"); destination == nil || !destination.IsDeleted() {
+		t.Fatalf("expected tombstone, got %+v", destination)
+	}
+	if err := sd.DeleteDestination("project", "unknown", "user"); err != ErrNoFound {
+		t.Errorf("expected ErrNoFound, got %v", err)
+	}
+
+	if err := sd.RestoreDestination("project", "first", "user"); err != nil {
+		t.Fatal(err)
+	}
+	if destination := projectDestination(t, sd.storage, "first"); destination == nil || destination.IsDeleted() {
+		t.Fatalf("expected restored destination, got %+v", destination)
+	}
+	revisions, err := sd.history.Revisions("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || revisions[0].Author != "user" || revisions[0].Comment != "restore destination first" {
+		t.Errorf("expected create, delete and restore revisions, got %+v", revisions)
+	}
+}
+
+func TestSoftDeletionRestoreTakenId(t *testing.T) {
+	sd, cleanup := newTestSoftDeletion(t, time.Hour)
+	defer cleanup()
+	if _, err := sd.history.Save("project", []*entities.Destination{{Uid: "first", Id: "pg"}}, "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sd.DeleteDestination("project", "first", "user"); err != nil {
+		t.Fatal(err)
+	}
+	projectDestinations, err := sd.storage.GetDestinationsByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the same _id is taken by a new destination after deletion
+	if _, err := sd.history.Save("project", append(projectDestinations, &entities.Destination{Uid: "second", Id: "pg"}), "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sd.RestoreDestination("project", "first", "user"); err != ErrDestinationIdConflict {
+		t.Errorf("expected ErrDestinationIdConflict, got %v", err)
+	}
+	if destination := projectDestination(t, sd.storage, "first"); destination == nil || !destination.IsDeleted() {
+		t.Errorf("destination with taken _id must stay deleted, got %+v", destination)
+	}
+}
+
+func TestSoftDeletionPurge(t *testing.T) {
+	sd, cleanup := newTestSoftDeletion(t, time.Hour)
+	defer cleanup()
+
+	expired := time.Now().UTC().Add(-2 * time.Hour).Format(LastUpdatedLayout)
+	recent := time.Now().UTC().Format(LastUpdatedLayout)
+	if _, err := sd.history.Save("project", []*entities.Destination{{Uid: "expired", Id: "first", DeletedAt: expired}, {Uid: "recent", Id: "second", DeletedAt: recent}}, "user", "create"); err != nil {
+		t.Fatal(err)
+	}
+	keys := []*entities.ApiKey{{Id: "expired", DeletedAt: expired}, {Id: "recent", DeletedAt: recent}, {Id: "alive"}}
+	if err := sd.storage.UpdateApiKeys("project", &entities.ApiKeys{LastUpdated: recent, Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+	domains := []*entities.CustomDomain{{Name: "expired.example.com", DeletedAt: expired}, {Name: "alive.example.com"}}
+	if err := sd.storage.UpdateCustomDomain("project", &entities.CustomDomains{LastUpdated: recent, Domains: domains}); err != nil {
+		t.Fatal(err)
+	}
+
+	sd.purge()
+
+	if projectDestination(t, sd.storage, "expired") != nil || projectDestination(t, sd.storage, "recent") == nil {
+		t.Error("only destinations deleted before retention period must be purged")
+	}
+	purgedKeys, err := sd.storage.GetApiKeysByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purgedKeys) != 2 || purgedKeys[0].Id != "recent" || purgedKeys[1].Id != "alive" {
+		t.Errorf("unexpected API keys after purge: %+v", purgedKeys)
+	}
+	purgedDomains, err := sd.storage.GetCustomDomainsByProjectId("project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purgedDomains.Domains) != 1 || purgedDomains.Domains[0].Name != "alive.example.com" {
+		t.Errorf("unexpected custom domains after purge: %+v", purgedDomains.Domains)
+	}
+}
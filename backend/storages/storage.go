@@ -0,0 +1,117 @@
+package storages
+
+import (
+	"context"
+	"errors"
+	"github.com/jitsucom/enhosted/destinations"
+	"github.com/jitsucom/enhosted/entities"
+	"github.com/jitsucom/enhosted/random"
+	"github.com/jitsucom/eventnative/logging"
+	"github.com/spf13/viper"
+	"io"
+	"time"
+)
+
+const (
+	defaultDatabaseCredentialsCollection = "default_database_credentials"
+	DestinationsCollection               = "destinations"
+	ApiKeysCollection                    = "api_keys"
+	customDomainsCollection              = "custom_domains"
+	destinationsHistoryCollection        = "destinations_history"
+	revisionsCollection                  = "revisions"
+	connectionTestsCollection            = "connection_tests"
+	destinationsSubcollection            = "destinations"
+	lastUpdatedField                     = "_lastUpdated"
+
+	clientSecretPrefix = "js"
+	serverSecretPrefix = "s2s"
+
+	LastUpdatedLayout = "2006-01-02T15:04:05.000Z"
+)
+
+var ErrNoFound = errors.New("Collection wasn't found")
+
+//watchedCollections are collections which changes are tracked by ChangeFeed
+var watchedCollections = []string{defaultDatabaseCredentialsCollection, DestinationsCollection, ApiKeysCollection, customDomainsCollection}
+
+//Storage is a main configuration storage (destinations, api keys, custom domains, default databases credentials)
+type Storage interface {
+	io.Closer
+	Changes() *ChangeFeed
+
+	CreateDatabase(projectId string) (*entities.Database, error)
+	GetDatabases() (map[string]*entities.Database, error)
+	UpdateDatabase(projectId string, database *entities.Database) error
+
+	GetDestinationsLastUpdated() (*time.Time, error)
+	GetDestinations() (map[string]*entities.Destinations, error)
+	GetDestinationsByProjectId(projectId string) ([]*entities.Destination, error)
+	UpdateDestinations(projectId string, destinations *entities.Destinations) error
+	//GetDestinationsRevisions return last revisions (all if limit is 0) ordered from newest to oldest
+	GetDestinationsRevisions(projectId string, limit int) ([]*entities.DestinationsRevision, error)
+	GetDestinationsRevision(projectId, revisionId string) (*entities.DestinationsRevision, error)
+	AddDestinationsRevision(projectId string, revision *entities.DestinationsRevision) error
+	//DeleteDestinationsRevision is used only for removing the revision of not saved destinations
+	DeleteDestinationsRevision(projectId, revisionId string) error
+
+	GetApiKeysLastUpdated() (*time.Time, error)
+	GetApiKeys() ([]*entities.ApiKey, error)
+	GetApiKeysGroupByProjectId() (map[string][]*entities.ApiKey, error)
+	GetApiKeysByProjectId(projectId string) ([]*entities.ApiKey, error)
+	UpdateApiKeys(projectId string, apiKeys *entities.ApiKeys) error
+	CreateDefaultApiKey(projectId string) error
+
+	//GetConnectionTests return last deep connection tests of the project destinations
+	GetConnectionTests(projectId string) ([]*entities.ConnectionTest, error)
+	//SaveConnectionTest replace the last connection test of the destination
+	SaveConnectionTest(projectId string, test *entities.ConnectionTest) error
+
+	GetCustomDomains() (map[string]*entities.CustomDomains, error)
+	GetCustomDomainsByProjectId(projectId string) (*entities.CustomDomains, error)
+	UpdateCustomDomain(projectId string, customDomains *entities.CustomDomains) error
+}
+
+//NewStorage return configured Storage implementation (firebase, postgres or local file)
+func NewStorage(ctx context.Context, storageViper *viper.Viper, defaultDestination *destinations.Postgres) (Storage, error) {
+	if storageViper == nil {
+		return nil, errors.New("storage is required config object")
+	}
+
+	if firebaseViper := storageViper.Sub("firebase"); firebaseViper != nil {
+		logging.Info("Main storage: firebase")
+		return NewFirebase(ctx, firebaseViper, defaultDestination)
+	}
+
+	if postgresViper := storageViper.Sub("postgres"); postgresViper != nil {
+		logging.Info("Main storage: postgres")
+		return NewPostgres(ctx, postgresViper, defaultDestination)
+	}
+
+	if localViper := storageViper.Sub("local"); localViper != nil {
+		logging.Info("Main storage: local file")
+		return NewLocal(localViper.GetString("path"), defaultDestination)
+	}
+
+	return nil, errors.New("storage is not set properly. Supported storages: firebase, postgres, local")
+}
+
+func generateDefaultAPIToken(projectId string) *entities.ApiKeys {
+	return &entities.ApiKeys{
+		LastUpdated: time.Now().UTC().Format(LastUpdatedLayout),
+		Keys:        []*entities.ApiKey{generateApiKey(projectId)},
+	}
+}
+
+//generateApiKey return a new project API key with random id and secrets
+func generateApiKey(projectId string) *entities.ApiKey {
+	apiKey := &entities.ApiKey{Id: projectId + "." + random.String(6)}
+	generateApiKeySecrets(projectId, apiKey)
+	return apiKey
+}
+
+//generateApiKeySecrets put new random client and server secrets into the API key. Secrets have js and s2s prefixes
+//and checksums so leaked ones are detected by secret scanners
+func generateApiKeySecrets(projectId string, apiKey *entities.ApiKey) {
+	apiKey.ClientSecret = random.Secret(clientSecretPrefix, projectId)
+	apiKey.ServerSecret = random.Secret(serverSecretPrefix, projectId)
+}